@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// cborMaxDepth bounds nesting so a hostile attestation object can't exhaust the stack.
+const cborMaxDepth = 16
+
+var errCBORMalformed = errors.New("malformed CBOR")
+
+// decodeCBOR decodes the first CBOR data item in data and returns it with the number of bytes it used.
+// Only the subset authenticators produce is supported: integers (int64), byte strings ([]byte),
+// text strings (string), arrays ([]interface{}), maps with integer or text keys
+// (map[interface{}]interface{}), booleans, null and floats. Indefinite lengths and tags are rejected.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > cborMaxDepth {
+		return nil, 0, errCBORMalformed
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORMalformed
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+
+	if major == 7 {
+		return decodeCBORSimple(data, info)
+	}
+
+	arg, n, err := readCBORArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, 0, errCBORMalformed
+		}
+		return int64(arg), n, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, 0, errCBORMalformed
+		}
+		return -1 - int64(arg), n, nil
+	case 2, 3:
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBORMalformed
+		}
+		end := n + int(arg)
+		if major == 2 {
+			value := make([]byte, arg)
+			copy(value, data[n:end])
+			return value, end, nil
+		}
+		return string(data[n:end]), end, nil
+	case 4:
+		// every item takes at least one byte, which keeps a huge length from allocating
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBORMalformed
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, used, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += used
+		}
+		return items, n, nil
+	case 5:
+		if arg > uint64(len(data)-n)/2 {
+			return nil, 0, errCBORMalformed
+		}
+		items := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, used, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errCBORMalformed
+			}
+			if _, exists := items[key]; exists {
+				return nil, 0, errCBORMalformed
+			}
+
+			value, used, err := decodeCBORItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			items[key] = value
+		}
+		return items, n, nil
+	}
+
+	// major type 6 (tags) is not used by WebAuthn
+	return nil, 0, errCBORMalformed
+}
+
+// readCBORArgument reads the length or value that follows the initial byte.
+func readCBORArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24 && len(data) >= 2:
+		return uint64(data[1]), 2, nil
+	case info == 25 && len(data) >= 3:
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case info == 26 && len(data) >= 5:
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case info == 27 && len(data) >= 9:
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	}
+	return 0, 0, errCBORMalformed
+}
+
+func decodeCBORSimple(data []byte, info byte) (interface{}, int, error) {
+	switch info {
+	case 20:
+		return false, 1, nil
+	case 21:
+		return true, 1, nil
+	case 22, 23:
+		return nil, 1, nil
+	case 25:
+		if len(data) < 3 {
+			return nil, 0, errCBORMalformed
+		}
+		return halfToFloat(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case 26:
+		if len(data) < 5 {
+			return nil, 0, errCBORMalformed
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data[1:]))), 5, nil
+	case 27:
+		if len(data) < 9 {
+			return nil, 0, errCBORMalformed
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data[1:])), 9, nil
+	}
+	return nil, 0, errCBORMalformed
+}
+
+func halfToFloat(bits uint16) float64 {
+	exponent := int(bits>>10) & 0x1f
+	mantissa := float64(bits & 0x3ff)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if bits&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
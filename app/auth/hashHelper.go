@@ -1,16 +1,23 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
-
+// HashPassword hashes password with the default PasswordHasher.
 func HashPassword(password string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return DefaultPasswordHasher().Hash(password)
+}
+
+// ComparePassword checks userPassword against a stored hash of any supported format.
+func ComparePassword(dbPassword, userPassword string) bool {
+	hasher, err := hasherFor(dbPassword)
 	if err != nil {
-		return "", err
+		return false
 	}
-	return string(hash), err
+	ok, err := hasher.Verify(dbPassword, userPassword)
+	return err == nil && ok
 }
 
-func ComparePassword(dbPassword, userPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(dbPassword), []byte(userPassword))
-	return err == nil
+// PasswordNeedsRehash reports whether a stored hash uses another algorithm or weaker parameters
+// than the default PasswordHasher, so it should be replaced the next time the password is known.
+func PasswordNeedsRehash(dbPassword string) bool {
+	hasher := DefaultPasswordHasher()
+	return !hasher.Recognizes(dbPassword) || hasher.NeedsRehash(dbPassword)
 }
@@ -1,40 +1,133 @@
 package auth
 
 import (
-	"fmt"
+	"errors"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
 )
 
-var secretKey = "rahasia"
+const (
+	TokenTypeAccess     = "access"
+	TokenTypeMfaPending = "mfa_pending"
+)
+
+var (
+	ErrTokenExpired = errors.New("token is expired")
+	ErrTokenInvalid = errors.New("unauthorized")
+)
+
+// AccessTokenTTL is how long an access token stays valid, configurable through JWT_ACCESS_TTL.
+func AccessTokenTTL() time.Duration {
+	return config.Duration("JWT_ACCESS_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL is how long a refresh token stays valid, configurable through JWT_REFRESH_TTL.
+func RefreshTokenTTL() time.Duration {
+	return config.Duration("JWT_REFRESH_TTL", 30*24*time.Hour)
+}
+
+// GenerateToken mints an access token. sessionId identifies the login (refresh token family)
+// the token belongs to so the session can be ended from the token alone.
+func GenerateToken(id uint, email string, roles []string, sessionId string) (string, error) {
+	now := time.Now()
+	jti, err := GenerateOpaqueToken(16)
+	if err != nil {
+		return "", err
+	}
 
-func GenerateToken(id uint, email string) string {
 	claims := jwt.MapClaims{
 		"id":    id,
 		"email": email,
+		"roles": roles,
+		"typ":   TokenTypeAccess,
+		"sid":   sessionId,
+		"jti":   jti,
+		"iat":   now.Unix(),
+		"exp":   now.Add(AccessTokenTTL()).Unix(),
+	}
+	return DefaultKeyring().Sign(claims)
+}
+
+// GenerateMfaToken mints the short-lived token returned by the first login step when the user
+// has two-factor authentication enabled. It can only be exchanged at /users/login/mfa.
+func GenerateMfaToken(id uint) (string, error) {
+	now := time.Now()
+	jti, err := GenerateOpaqueToken(16)
+	if err != nil {
+		return "", err
 	}
-	parseToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, _ := parseToken.SignedString([]byte(secretKey))
 
-	return signedToken
+	claims := jwt.MapClaims{
+		"id":  id,
+		"typ": TokenTypeMfaPending,
+		"jti": jti,
+		"iat": now.Unix(),
+		"exp": now.Add(MfaTokenTTL()).Unix(),
+	}
+	return DefaultKeyring().Sign(claims)
 }
 
-func VerifyToken(tokenString string) (interface{}, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unauthorized")
-		}
+// MfaTokenTTL is how long the user has to enter their second factor, configurable through MFA_TOKEN_TTL.
+func MfaTokenTTL() time.Duration {
+	return config.Duration("MFA_TOKEN_TTL", 5*time.Minute)
+}
+
+func VerifyToken(tokenString string) (jwt.MapClaims, error) {
+	return verifyToken(tokenString, TokenTypeAccess)
+}
+
+// VerifyMfaToken verifies a token minted by GenerateMfaToken.
+func VerifyMfaToken(tokenString string) (jwt.MapClaims, error) {
+	return verifyToken(tokenString, TokenTypeMfaPending)
+}
 
-		return []byte(secretKey), nil
-	})
+func verifyToken(tokenString string, tokenType string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, DefaultKeyring().Keyfunc)
 
 	if err != nil {
-		return nil, err
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrTokenInvalid
 	}
 
-	if _, ok := token.Claims.(jwt.MapClaims); !ok && !token.Valid {
-		return nil, fmt.Errorf("unauthorized")
+	// tokens minted before expiry was introduced carry no exp and must not be accepted
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrTokenExpired
 	}
 
-	return token.Claims.(jwt.MapClaims), nil
+	if claims["typ"] != tokenType {
+		return nil, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// ClaimTime converts a NumericDate claim such as "iat" or "exp" into a time.Time.
+func ClaimTime(claims jwt.MapClaims, name string) time.Time {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(value), 0)
+}
+
+// ClaimRoles reads the "roles" claim.
+func ClaimRoles(claims jwt.MapClaims) []string {
+	values, _ := claims["roles"].([]interface{})
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
 }
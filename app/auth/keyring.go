@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+// SigningKey is a key in the keyring. Retired keys only need VerifyKey.
+type SigningKey struct {
+	Id        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// Keyring signs tokens with its active key and verifies tokens signed by any key it holds,
+// so tokens issued before a rotation stay valid until they expire.
+type Keyring struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// JSONWebKey is the public half of a signing key as published in the JWKS document.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+var (
+	keyringMu sync.RWMutex
+	keyring   *Keyring
+)
+
+func NewKeyring(active *SigningKey, retired ...*SigningKey) *Keyring {
+	keys := map[string]*SigningKey{active.Id: active}
+	for _, key := range retired {
+		keys[key.Id] = key
+	}
+
+	return &Keyring{
+		active: active,
+		keys:   keys,
+	}
+}
+
+// SetKeyring replaces the keyring used by GenerateToken and VerifyToken.
+func SetKeyring(ring *Keyring) {
+	keyringMu.Lock()
+	keyring = ring
+	keyringMu.Unlock()
+}
+
+// DefaultKeyring returns the keyring set with SetKeyring, loading it from the environment on first use.
+func DefaultKeyring() *Keyring {
+	keyringMu.RLock()
+	ring := keyring
+	keyringMu.RUnlock()
+	if ring != nil {
+		return ring
+	}
+
+	ring, err := LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	SetKeyring(ring)
+	return ring
+}
+
+// Sign signs the claims with the active key and sets the kid header.
+func (ring *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ring.active.Method, claims)
+	token.Header["kid"] = ring.active.Id
+	return token.SignedString(ring.active.SignKey)
+}
+
+// Keyfunc resolves the verification key from the token's kid header. The token's alg must
+// match the algorithm the key was registered with.
+func (ring *Keyring) Keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+	}
+	return key.VerifyKey, nil
+}
+
+// JWKS returns the public keys of every asymmetric key in the ring. HMAC secrets are never published.
+func (ring *Keyring) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ring.keys {
+		switch publicKey := key.VerifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "RSA",
+				Kid: key.Id,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "OKP",
+				Kid: key.Id,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+// LoadKeyringFromEnv builds the keyring from:
+//
+//	JWT_ALG              HS256 (default), RS256 or EdDSA
+//	JWT_KEY_ID           kid of the active key
+//	JWT_SECRET           HMAC secret for HS256
+//	JWT_PRIVATE_KEY_FILE PEM private key for RS256 / EdDSA
+//	JWT_RETIRED_KEYS     comma separated kid:alg:path entries of keys that only verify;
+//	                     path is a PEM key (public or private) or a file holding an HMAC secret
+func LoadKeyringFromEnv() (*Keyring, error) {
+	alg := config.Get("JWT_ALG", jwt.SigningMethodHS256.Alg())
+	kid := config.Get("JWT_KEY_ID", "default")
+
+	var active *SigningKey
+	var err error
+	if alg == jwt.SigningMethodHS256.Alg() {
+		secret := config.Get("JWT_SECRET", "")
+		if path := config.Get("JWT_SECRET_FILE", ""); secret == "" && path != "" {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			secret = strings.TrimSpace(string(content))
+		}
+		if secret == "" {
+			log.Println("JWT_SECRET is not set, using a random secret; tokens will not survive a restart")
+			if secret, err = GenerateOpaqueToken(32); err != nil {
+				return nil, err
+			}
+		}
+		active = &SigningKey{Id: kid, Method: jwt.SigningMethodHS256, SignKey: []byte(secret), VerifyKey: []byte(secret)}
+	} else {
+		path := config.Get("JWT_PRIVATE_KEY_FILE", "")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", alg)
+		}
+		if active, err = loadKeyFile(kid, alg, path); err != nil {
+			return nil, err
+		}
+		if active.SignKey == nil {
+			return nil, fmt.Errorf("%s does not contain a private key", path)
+		}
+	}
+
+	var retired []*SigningKey
+	for _, entry := range config.List("JWT_RETIRED_KEYS", nil) {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid JWT_RETIRED_KEYS entry %q, expected kid:alg:path", entry)
+		}
+		key, err := loadKeyFile(parts[0], parts[1], parts[2])
+		if err != nil {
+			return nil, err
+		}
+		retired = append(retired, key)
+	}
+
+	return NewKeyring(active, retired...), nil
+}
+
+func loadKeyFile(kid, alg, path string) (*SigningKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch alg {
+	case jwt.SigningMethodHS256.Alg():
+		secret := []byte(strings.TrimSpace(string(content)))
+		return &SigningKey{Id: kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil
+	case jwt.SigningMethodRS256.Alg():
+		if privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(content); err == nil {
+			return &SigningKey{Id: kid, Method: jwt.SigningMethodRS256, SignKey: privateKey, VerifyKey: &privateKey.PublicKey}, nil
+		}
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &SigningKey{Id: kid, Method: jwt.SigningMethodRS256, VerifyKey: publicKey}, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		if privateKey, err := jwt.ParseEdPrivateKeyFromPEM(content); err == nil {
+			edKey := privateKey.(ed25519.PrivateKey)
+			return &SigningKey{Id: kid, Method: jwt.SigningMethodEdDSA, SignKey: edKey, VerifyKey: edKey.Public()}, nil
+		}
+		publicKey, err := jwt.ParseEdPublicKeyFromPEM(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &SigningKey{Id: kid, Method: jwt.SigningMethodEdDSA, VerifyKey: publicKey}, nil
+	}
+
+	return nil, errors.New("unsupported signing algorithm " + alg)
+}
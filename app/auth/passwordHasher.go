@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms, selected with PASSWORD_HASH_ALGORITHM
+const (
+	HashAlgorithmArgon2id = "argon2id"
+	HashAlgorithmBcrypt   = "bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("password hash format is not recognised")
+
+// PasswordHasher hashes passwords into a self-describing encoded string.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches an encoded hash this hasher understands.
+	Verify(encoded, password string) (bool, error)
+	// Recognizes reports whether encoded was produced by this hasher's algorithm.
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded uses weaker parameters than the hasher is configured with.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher encodes hashes in the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idHash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+var (
+	argon2SlotsOnce sync.Once
+	argon2Slots     chan struct{}
+)
+
+// acquireArgon2 blocks until fewer than ARGON2_MAX_CONCURRENT (default: the number of CPUs)
+// derivations are running. Each one allocates ARGON2_MEMORY, so a burst of logins would otherwise
+// multiply that by the number of requests in flight. The returned func releases the slot.
+func acquireArgon2() func() {
+	argon2SlotsOnce.Do(func() {
+		size := config.Int("ARGON2_MAX_CONCURRENT", runtime.NumCPU())
+		if size < 1 {
+			size = 1
+		}
+		argon2Slots = make(chan struct{}, size)
+	})
+
+	argon2Slots <- struct{}{}
+	return func() { <-argon2Slots }
+}
+
+func (hasher Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, hasher.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	release := acquireArgon2()
+	defer release()
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Iterations, hasher.Memory, hasher.Parallelism, hasher.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, hasher.Memory, hasher.Iterations, hasher.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (hasher Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	release := acquireArgon2()
+	defer release()
+
+	key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+	return subtle.ConstantTimeCompare(key, hash.key) == 1, nil
+}
+
+func (hasher Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (hasher Argon2idHasher) NeedsRehash(encoded string) bool {
+	hash, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return hash.memory < hasher.Memory ||
+		hash.iterations < hasher.Iterations ||
+		hash.parallelism < hasher.Parallelism ||
+		uint32(len(hash.salt)) < hasher.SaltLength ||
+		uint32(len(hash.key)) < hasher.KeyLength
+}
+
+func decodeArgon2id(encoded string) (argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+
+	var hash argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism); err != nil {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+	if hash.memory == 0 || hash.iterations == 0 || hash.parallelism == 0 {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return argon2idHash{}, ErrUnknownHashFormat
+	}
+	return hash, nil
+}
+
+// BcryptHasher produces the standard $2a$<cost>$ encoding.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (hasher BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), hasher.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (hasher BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (hasher BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (hasher BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < hasher.Cost
+}
+
+var (
+	passwordHasherMu sync.RWMutex
+	passwordHasher   PasswordHasher
+)
+
+// SetPasswordHasher replaces the hasher new passwords are hashed with.
+func SetPasswordHasher(hasher PasswordHasher) {
+	passwordHasherMu.Lock()
+	passwordHasher = hasher
+	passwordHasherMu.Unlock()
+}
+
+// DefaultPasswordHasher returns the hasher set with SetPasswordHasher, loading it from the environment on first use.
+func DefaultPasswordHasher() PasswordHasher {
+	passwordHasherMu.RLock()
+	hasher := passwordHasher
+	passwordHasherMu.RUnlock()
+	if hasher != nil {
+		return hasher
+	}
+
+	passwordHasherMu.Lock()
+	defer passwordHasherMu.Unlock()
+	if passwordHasher == nil {
+		passwordHasher = PasswordHasherFromEnv()
+	}
+	return passwordHasher
+}
+
+// PasswordHasherFromEnv reads PASSWORD_HASH_ALGORITHM and the ARGON2_* or BCRYPT_COST parameters.
+func PasswordHasherFromEnv() PasswordHasher {
+	switch algorithm := config.Get("PASSWORD_HASH_ALGORITHM", HashAlgorithmArgon2id); algorithm {
+	case HashAlgorithmBcrypt:
+		return BcryptHasher{Cost: config.Int("BCRYPT_COST", bcrypt.DefaultCost)}
+	default:
+		if algorithm != HashAlgorithmArgon2id {
+			log.Printf("unknown PASSWORD_HASH_ALGORITHM %q, using argon2id", algorithm)
+		}
+		return Argon2idHasher{
+			Memory:      uint32(config.Int("ARGON2_MEMORY", 64*1024)),
+			Iterations:  uint32(config.Int("ARGON2_ITERATIONS", 3)),
+			Parallelism: uint8(config.Int("ARGON2_PARALLELISM", 2)),
+			SaltLength:  16,
+			KeyLength:   32,
+		}
+	}
+}
+
+// knownHashers can verify every format that may still be stored, whatever the current default is.
+var knownHashers = []PasswordHasher{Argon2idHasher{}, BcryptHasher{}}
+
+func hasherFor(encoded string) (PasswordHasher, error) {
+	if current := DefaultPasswordHasher(); current.Recognizes(encoded) {
+		return current, nil
+	}
+	for _, hasher := range knownHashers {
+		if hasher.Recognizes(encoded) {
+			return hasher, nil
+		}
+	}
+	return nil, ErrUnknownHashFormat
+}
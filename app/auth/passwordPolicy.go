@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+// breachPrefixLength is how many leading hex characters of a SHA-1 hash name its range file,
+// as in the Have I Been Pwned k-anonymity API.
+const breachPrefixLength = 5
+
+// PasswordPolicy decides whether a new password is acceptable.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinEntropy is the minimum estimated strength in bits, see EstimatePasswordEntropy
+	MinEntropy float64
+	// DisallowPersonal rejects passwords containing the username or email
+	DisallowPersonal bool
+	// Breached is consulted last; nil skips the check
+	Breached BreachChecker
+}
+
+// BreachChecker reports whether a password is known from a data breach.
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// BreachedPasswordDir looks passwords up in a directory of k-anonymity range files. Each file is
+// named after the first five hex characters of a SHA-1 hash (optionally with a .txt extension)
+// and holds "SUFFIX:COUNT" lines, exactly as returned by https://api.pwnedpasswords.com/range/{prefix}.
+// Only the one file for the password's prefix is read.
+type BreachedPasswordDir struct {
+	Dir string
+	// MinCount ignores hashes seen fewer times than this
+	MinCount int
+}
+
+// PasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH, PASSWORD_MIN_ENTROPY,
+// PASSWORD_DISALLOW_PERSONAL, BREACHED_PASSWORDS_DIR and BREACHED_PASSWORDS_MIN_COUNT.
+func PasswordPolicyFromEnv() PasswordPolicy {
+	minEntropy, err := strconv.ParseFloat(config.Get("PASSWORD_MIN_ENTROPY", "40"), 64)
+	if err != nil {
+		log.Println("invalid PASSWORD_MIN_ENTROPY, using 40:", err)
+		minEntropy = 40
+	}
+
+	policy := PasswordPolicy{
+		MinLength:        config.Int("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:        config.Int("PASSWORD_MAX_LENGTH", 128),
+		MinEntropy:       minEntropy,
+		DisallowPersonal: config.Bool("PASSWORD_DISALLOW_PERSONAL", true),
+	}
+	if dir := config.Get("BREACHED_PASSWORDS_DIR", ""); dir != "" {
+		policy.Breached = BreachedPasswordDir{
+			Dir:      dir,
+			MinCount: config.Int("BREACHED_PASSWORDS_MIN_COUNT", 1),
+		}
+	}
+	return policy
+}
+
+// Check returns a message for every rule password breaks; none means it is acceptable.
+// personal holds values the password must not contain, such as the username and email.
+func (policy PasswordPolicy) Check(password string, personal ...string) []string {
+	var problems []string
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("Password has to have a minimum length of %d characters", policy.MinLength))
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		problems = append(problems, fmt.Sprintf("Password can have at most %d characters", policy.MaxLength))
+	}
+
+	if policy.DisallowPersonal {
+		lowered := strings.ToLower(password)
+		for _, value := range personalFragments(personal) {
+			if strings.Contains(lowered, value) {
+				problems = append(problems, "Password must not contain your username or email")
+				break
+			}
+		}
+	}
+
+	if policy.MinEntropy > 0 && EstimatePasswordEntropy(password) < policy.MinEntropy {
+		problems = append(problems, "Password is too easy to guess, use a longer mix of words, numbers and symbols")
+	}
+
+	// the breach list is only worth reading for passwords that pass everything else
+	if len(problems) == 0 && policy.Breached != nil {
+		breached, err := policy.Breached.Breached(password)
+		if err != nil {
+			log.Println("breached password check:", err)
+		} else if breached {
+			problems = append(problems, "Password has appeared in a data breach, choose a different one")
+		}
+	}
+
+	return problems
+}
+
+// personalFragments lowercases the personal values and adds the local part of emails.
+// Very short fragments are skipped since they would reject too many passwords.
+func personalFragments(values []string) []string {
+	fragments := make([]string, 0, len(values)*2)
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			fragments = append(fragments, value[:at])
+		}
+		fragments = append(fragments, value)
+	}
+
+	kept := fragments[:0]
+	for _, fragment := range fragments {
+		if utf8.RuneCountInString(fragment) >= 3 {
+			kept = append(kept, fragment)
+		}
+	}
+	return kept
+}
+
+// EstimatePasswordEntropy gives a rough strength in bits: log2 of the character pool the password
+// draws from times its length, not counting characters that repeat the previous one or continue
+// a run like "abc" or "321".
+func EstimatePasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, char := range password {
+		switch {
+		case char >= 'a' && char <= 'z':
+			lower = true
+		case char >= 'A' && char <= 'Z':
+			upper = true
+		case char >= '0' && char <= '9':
+			digit = true
+		case char < unicode.MaxASCII && unicode.IsPrint(char):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	effective := 0
+	var previous rune
+	step := rune(0)
+	for i, char := range []rune(password) {
+		if i > 0 {
+			delta := char - previous
+			if delta == 0 || ((delta == 1 || delta == -1) && delta == step) {
+				step = delta
+				previous = char
+				continue
+			}
+			step = delta
+		}
+		effective++
+		previous = char
+	}
+
+	return float64(effective) * math.Log2(float64(pool))
+}
+
+func (breached BreachedPasswordDir) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachPrefixLength], hash[breachPrefixLength:]
+
+	file, err := breached.open(prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, count, _ := strings.Cut(line, ":")
+		if !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+
+		seen, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil {
+			// a bare hash without a count still means it was breached
+			seen = 1
+		}
+		return seen >= breached.MinCount, nil
+	}
+	return false, scanner.Err()
+}
+
+func (breached BreachedPasswordDir) open(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(breached.Dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(breached.Dir, prefix+".txt"))
+	}
+	return file, err
+}
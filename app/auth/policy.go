@@ -0,0 +1,72 @@
+package auth
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	ResourcePhoto   = "photo"
+	ResourceComment = "comment"
+	ResourceSocial  = "social"
+	ResourceUser    = "user"
+
+	ActionUpdate     = "update"
+	ActionDelete     = "delete"
+	ActionAssignRole = "assign_role"
+)
+
+// rolePermissions lists what each role may do to resources owned by someone else.
+// Owners can always update and delete their own resources.
+var rolePermissions = map[string]map[string]bool{
+	RoleModerator: {
+		ResourcePhoto + ":" + ActionUpdate:   true,
+		ResourcePhoto + ":" + ActionDelete:   true,
+		ResourceComment + ":" + ActionUpdate: true,
+		ResourceComment + ":" + ActionDelete: true,
+		ResourceSocial + ":" + ActionUpdate:  true,
+		ResourceSocial + ":" + ActionDelete:  true,
+	},
+	RoleAdmin: {
+		ResourcePhoto + ":" + ActionUpdate:    true,
+		ResourcePhoto + ":" + ActionDelete:    true,
+		ResourceComment + ":" + ActionUpdate:  true,
+		ResourceComment + ":" + ActionDelete:  true,
+		ResourceSocial + ":" + ActionUpdate:   true,
+		ResourceSocial + ":" + ActionDelete:   true,
+		ResourceUser + ":" + ActionAssignRole: true,
+	},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// HasRole reports whether roles contains any of wanted.
+func HasRole(roles []string, wanted ...string) bool {
+	for _, role := range roles {
+		for _, want := range wanted {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authorize is the single place that decides whether actorId, holding roles, may perform
+// action on a resource owned by ownerId.
+func Authorize(actorId uint, roles []string, action, resource string, ownerId uint) bool {
+	if actorId != 0 && actorId == ownerId && action != ActionAssignRole {
+		return true
+	}
+
+	for _, role := range roles {
+		if rolePermissions[role][resource+":"+action] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// How a request was authenticated
+const (
+	AuthMethodToken  = "token"
+	AuthMethodApiKey = "api_key"
+)
+
+// ErrMalformedClaims is returned when a correctly signed token carries claims of the wrong shape.
+var ErrMalformedClaims = errors.New("token claims are malformed")
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserId    uint
+	Email     string
+	Roles     []string
+	Scopes    []string
+	SessionId string
+	// TokenId and ExpiresAt describe the access token; they are empty for API keys
+	TokenId   string
+	ExpiresAt time.Time
+	Method    string
+}
+
+// HasRole reports whether the principal holds at least one of roles.
+func (principal Principal) HasRole(roles ...string) bool {
+	return HasRole(principal.Roles, roles...)
+}
+
+// HasScope reports whether the credential used for the request was granted scope.
+func (principal Principal) HasScope(scope string) bool {
+	return HasScope(principal.Scopes, scope)
+}
+
+// Can applies the central policy to the principal acting on a resource owned by ownerId.
+func (principal Principal) Can(action, resource string, ownerId uint) bool {
+	return Authorize(principal.UserId, principal.Roles, action, resource, ownerId)
+}
+
+// PrincipalFromClaims builds the principal of a verified access token. Interactive logins hold every scope.
+func PrincipalFromClaims(claims jwt.MapClaims) (Principal, error) {
+	userId, err := ClaimUserId(claims)
+	if err != nil {
+		return Principal{}, err
+	}
+	email, ok := claims["email"].(string)
+	if !ok {
+		return Principal{}, ErrMalformedClaims
+	}
+	sessionId, ok := claims["sid"].(string)
+	if !ok || sessionId == "" {
+		return Principal{}, ErrMalformedClaims
+	}
+	tokenId, ok := claims["jti"].(string)
+	if !ok || tokenId == "" {
+		return Principal{}, ErrMalformedClaims
+	}
+
+	return Principal{
+		UserId:    userId,
+		Email:     email,
+		Roles:     ClaimRoles(claims),
+		Scopes:    []string{ScopeAll},
+		SessionId: sessionId,
+		TokenId:   tokenId,
+		ExpiresAt: ClaimTime(claims, "exp"),
+		Method:    AuthMethodToken,
+	}, nil
+}
+
+// ClaimUserId reads the "id" claim, which JSON decoding turns into a float64.
+func ClaimUserId(claims jwt.MapClaims) (uint, error) {
+	value, ok := claims["id"].(float64)
+	if !ok || value < 1 || value > math.MaxUint32 || value != math.Trunc(value) {
+		return 0, ErrMalformedClaims
+	}
+	return uint(value), nil
+}
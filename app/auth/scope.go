@@ -0,0 +1,61 @@
+package auth
+
+import "strings"
+
+const (
+	ScopePhotosRead    = "photos:read"
+	ScopePhotosWrite   = "photos:write"
+	ScopeCommentsRead  = "comments:read"
+	ScopeCommentsWrite = "comments:write"
+	ScopeSocialsRead   = "socials:read"
+	ScopeSocialsWrite  = "socials:write"
+	ScopeFollowsRead   = "follows:read"
+	ScopeFollowsWrite  = "follows:write"
+
+	// ScopeAccount covers account management (password, sessions, API keys). It is never
+	// granted to an API key, only to interactive logins.
+	ScopeAccount = "account"
+	// ScopeAll is held by interactive logins.
+	ScopeAll = "*"
+)
+
+// APIKeyScopes are the scopes a user can grant to an API key.
+var APIKeyScopes = []string{
+	ScopePhotosRead,
+	ScopePhotosWrite,
+	ScopeCommentsRead,
+	ScopeCommentsWrite,
+	ScopeSocialsRead,
+	ScopeSocialsWrite,
+	ScopeFollowsRead,
+	ScopeFollowsWrite,
+}
+
+// ValidAPIKeyScope reports whether scope can be granted to an API key.
+func ValidAPIKeyScope(scope string) bool {
+	for _, allowed := range APIKeyScopes {
+		if scope == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether granted covers scope.
+func HasScope(granted []string, scope string) bool {
+	for _, candidate := range granted {
+		if candidate == ScopeAll || candidate == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinScopes and SplitScopes convert between a scope list and its space separated storage form.
+func JoinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func SplitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
@@ -0,0 +1,359 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+// COSE algorithm identifiers for the signature schemes passkeys are accepted with
+const (
+	COSEAlgES256 int64 = -7
+	COSEAlgEdDSA int64 = -8
+	COSEAlgRS256 int64 = -257
+)
+
+const (
+	webAuthnTypeCreate = "webauthn.create"
+	webAuthnTypeGet    = "webauthn.get"
+
+	authDataFlagUserPresent  = 0x01
+	authDataFlagUserVerified = 0x04
+	authDataFlagAttested     = 0x40
+)
+
+var (
+	ErrWebAuthnClientData   = errors.New("webauthn client data is invalid")
+	ErrWebAuthnChallenge    = errors.New("webauthn challenge does not match")
+	ErrWebAuthnOrigin       = errors.New("webauthn origin is not allowed")
+	ErrWebAuthnAuthData     = errors.New("webauthn authenticator data is invalid")
+	ErrWebAuthnUserPresence = errors.New("webauthn user presence is required")
+	ErrWebAuthnVerification = errors.New("webauthn user verification is required")
+	ErrWebAuthnPublicKey    = errors.New("webauthn public key is invalid or unsupported")
+	ErrWebAuthnSignature    = errors.New("webauthn signature is invalid")
+	ErrWebAuthnSignCount    = errors.New("webauthn sign counter went backwards, the authenticator may be cloned")
+	ErrWebAuthnAttestation  = errors.New("webauthn attestation object is invalid")
+	ErrWebAuthnType         = errors.New("webauthn ceremony type does not match")
+)
+
+// WebAuthnAlgorithms lists the COSE algorithms offered to authenticators, most preferred first.
+var WebAuthnAlgorithms = []int64{COSEAlgES256, COSEAlgEdDSA, COSEAlgRS256}
+
+// RelyingParty describes this server to WebAuthn authenticators.
+type RelyingParty struct {
+	Id      string
+	Name    string
+	Origins []string
+	// RequireUserVerification rejects assertions where the authenticator did not check a PIN or biometric
+	RequireUserVerification bool
+	Timeout                 time.Duration
+}
+
+// ClientData is the part of clientDataJSON that the server checks.
+type ClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// WebAuthnCredential is a newly registered credential. PublicKey is kept in its COSE encoding.
+type WebAuthnCredential struct {
+	Id           []byte
+	PublicKey    []byte
+	Algorithm    int64
+	SignCount    uint32
+	Aaguid       []byte
+	UserVerified bool
+}
+
+// WebAuthnAssertion is the outcome of a verified login assertion.
+type WebAuthnAssertion struct {
+	SignCount    uint32
+	UserVerified bool
+}
+
+type authenticatorData struct {
+	rpIdHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialId []byte
+	publicKey    []byte
+}
+
+// RelyingPartyFromEnv reads WEBAUTHN_RP_ID, WEBAUTHN_RP_NAME, WEBAUTHN_ORIGINS, WEBAUTHN_REQUIRE_UV and WEBAUTHN_TIMEOUT.
+func RelyingPartyFromEnv() RelyingParty {
+	return RelyingParty{
+		Id:                      config.Get("WEBAUTHN_RP_ID", "localhost"),
+		Name:                    config.Get("WEBAUTHN_RP_NAME", "MyGRAM"),
+		Origins:                 config.List("WEBAUTHN_ORIGINS", []string{"http://localhost:8080"}),
+		RequireUserVerification: config.Bool("WEBAUTHN_REQUIRE_UV", false),
+		Timeout:                 config.Duration("WEBAUTHN_TIMEOUT", 5*time.Minute),
+	}
+}
+
+// GenerateWebAuthnChallenge returns a random base64url challenge, which is how it appears in clientDataJSON.
+func GenerateWebAuthnChallenge() (string, error) {
+	return GenerateOpaqueToken(32)
+}
+
+// ParseClientData decodes clientDataJSON so the caller can find the challenge it was issued for.
+func ParseClientData(clientDataJSON []byte) (ClientData, error) {
+	var clientData ClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return ClientData{}, ErrWebAuthnClientData
+	}
+	if clientData.Type == "" || clientData.Challenge == "" || clientData.Origin == "" {
+		return ClientData{}, ErrWebAuthnClientData
+	}
+	return clientData, nil
+}
+
+// VerifyRegistration checks the response to navigator.credentials.create() and returns the new credential.
+// Attestation is not requested, so the attestation statement is ignored and the key is trusted on first use.
+func (rp RelyingParty) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*WebAuthnCredential, error) {
+	if err := rp.verifyClientData(clientDataJSON, webAuthnTypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, ErrWebAuthnAttestation
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnAttestation
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, ErrWebAuthnAttestation
+	}
+
+	authData, err := rp.parseAuthData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&authDataFlagAttested == 0 {
+		return nil, ErrWebAuthnAuthData
+	}
+	if rp.RequireUserVerification && authData.flags&authDataFlagUserVerified == 0 {
+		return nil, ErrWebAuthnVerification
+	}
+
+	alg, _, err := parseCOSEKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnCredential{
+		Id:           authData.credentialId,
+		PublicKey:    authData.publicKey,
+		Algorithm:    alg,
+		SignCount:    authData.signCount,
+		Aaguid:       authData.aaguid,
+		UserVerified: authData.flags&authDataFlagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks the response to navigator.credentials.get() against a stored COSE public key
+// and the sign counter last seen for it.
+func (rp RelyingParty) VerifyAssertion(challenge string, clientDataJSON, rawAuthData, signature, publicKey []byte, storedSignCount uint32) (WebAuthnAssertion, error) {
+	if err := rp.verifyClientData(clientDataJSON, webAuthnTypeGet, challenge); err != nil {
+		return WebAuthnAssertion{}, err
+	}
+
+	authData, err := rp.parseAuthData(rawAuthData)
+	if err != nil {
+		return WebAuthnAssertion{}, err
+	}
+	if rp.RequireUserVerification && authData.flags&authDataFlagUserVerified == 0 {
+		return WebAuthnAssertion{}, ErrWebAuthnVerification
+	}
+
+	alg, key, err := parseCOSEKey(publicKey)
+	if err != nil {
+		return WebAuthnAssertion{}, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := make([]byte, 0, len(rawAuthData)+len(clientDataHash))
+	signed = append(signed, rawAuthData...)
+	signed = append(signed, clientDataHash[:]...)
+	if !verifyCOSESignature(alg, key, signed, signature) {
+		return WebAuthnAssertion{}, ErrWebAuthnSignature
+	}
+
+	// authenticators that don't keep a counter always report zero
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return WebAuthnAssertion{}, ErrWebAuthnSignCount
+	}
+
+	return WebAuthnAssertion{
+		SignCount:    authData.signCount,
+		UserVerified: authData.flags&authDataFlagUserVerified != 0,
+	}, nil
+}
+
+func (rp RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	clientData, err := ParseClientData(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if clientData.Type != ceremony {
+		return ErrWebAuthnType
+	}
+	if clientData.Challenge != challenge {
+		return ErrWebAuthnChallenge
+	}
+	if clientData.CrossOrigin {
+		return ErrWebAuthnOrigin
+	}
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return ErrWebAuthnOrigin
+}
+
+// parseAuthData decodes authenticator data: rpIdHash(32) flags(1) signCount(4) [attested credential data].
+func (rp RelyingParty) parseAuthData(data []byte) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, ErrWebAuthnAuthData
+	}
+
+	authData := authenticatorData{
+		rpIdHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIdHash := sha256.Sum256([]byte(rp.Id))
+	if !bytes.Equal(authData.rpIdHash, rpIdHash[:]) {
+		return authenticatorData{}, ErrWebAuthnAuthData
+	}
+	if authData.flags&authDataFlagUserPresent == 0 {
+		return authenticatorData{}, ErrWebAuthnUserPresence
+	}
+
+	if authData.flags&authDataFlagAttested == 0 {
+		return authData, nil
+	}
+
+	rest := data[37:]
+	if len(rest) < 18 {
+		return authenticatorData{}, ErrWebAuthnAuthData
+	}
+	authData.aaguid = rest[:16]
+	idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+		return authenticatorData{}, ErrWebAuthnAuthData
+	}
+	authData.credentialId = rest[:idLength]
+	rest = rest[idLength:]
+
+	_, used, err := decodeCBOR(rest)
+	if err != nil {
+		return authenticatorData{}, ErrWebAuthnPublicKey
+	}
+	authData.publicKey = rest[:used]
+	return authData, nil
+}
+
+// parseCOSEKey accepts EC2 P-256 (ES256), OKP Ed25519 (EdDSA) and RSA (RS256) keys.
+func parseCOSEKey(data []byte) (int64, crypto.PublicKey, error) {
+	decoded, used, err := decodeCBOR(data)
+	if err != nil || used != len(data) {
+		return 0, nil, ErrWebAuthnPublicKey
+	}
+	coseKey, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, ErrWebAuthnPublicKey
+	}
+
+	kty, _ := coseKey[int64(1)].(int64)
+	alg, _ := coseKey[int64(3)].(int64)
+	crv, _ := coseKey[int64(-1)].(int64)
+
+	switch {
+	case kty == 2 && alg == COSEAlgES256 && crv == 1:
+		x, _ := coseKey[int64(-2)].([]byte)
+		y, _ := coseKey[int64(-3)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return 0, nil, ErrWebAuthnPublicKey
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return 0, nil, ErrWebAuthnPublicKey
+		}
+		return alg, key, nil
+	case kty == 1 && alg == COSEAlgEdDSA && crv == 6:
+		x, _ := coseKey[int64(-2)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return 0, nil, ErrWebAuthnPublicKey
+		}
+		return alg, ed25519.PublicKey(x), nil
+	case kty == 3 && alg == COSEAlgRS256:
+		n, _ := coseKey[int64(-1)].([]byte)
+		e, _ := coseKey[int64(-2)].([]byte)
+		if len(e) == 0 || len(e) > 4 {
+			return 0, nil, ErrWebAuthnPublicKey
+		}
+		// the exponent has to be odd, at least 3 and fit in an int32 the way crypto/rsa expects;
+		// the length check alone would let 0, 1 or an even exponent through
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e).Int64()
+		if modulus.BitLen() < 2048 || exponent < 3 || exponent > math.MaxInt32 || exponent%2 == 0 {
+			return 0, nil, ErrWebAuthnPublicKey
+		}
+		return alg, &rsa.PublicKey{N: modulus, E: int(exponent)}, nil
+	}
+	return 0, nil, ErrWebAuthnPublicKey
+}
+
+func verifyCOSESignature(alg int64, key crypto.PublicKey, signed, signature []byte) bool {
+	switch alg {
+	case COSEAlgES256:
+		digest := sha256.Sum256(signed)
+		return ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], signature)
+	case COSEAlgEdDSA:
+		return ed25519.Verify(key.(ed25519.PublicKey), signed, signature)
+	case COSEAlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+// WebAuthnUserHandle is the opaque user.id given to authenticators. It is returned as userHandle on login.
+func WebAuthnUserHandle(userId uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userId))
+	return handle
+}
+
+// EncodeWebAuthnData base64url encodes binary WebAuthn fields (ids, challenges, user handles) the way browsers send them.
+func EncodeWebAuthnData(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// DecodeWebAuthnData decodes a base64url WebAuthn field, with or without padding.
+func DecodeWebAuthnData(id string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(id, "="))
+}
@@ -0,0 +1,365 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const testOrigin = "http://localhost:8080"
+
+func testRelyingParty() RelyingParty {
+	return RelyingParty{Id: "localhost", Name: "MyGRAM", Origins: []string{testOrigin}}
+}
+
+// cborPair is one entry of a CBOR map; a slice of them keeps the encoding order deterministic.
+type cborPair struct {
+	key   interface{}
+	value interface{}
+}
+
+func encodeCBORHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n < 1<<8:
+		return []byte{major<<5 | 24, byte(n)}
+	case n < 1<<16:
+		head := []byte{major<<5 | 25, 0, 0}
+		binary.BigEndian.PutUint16(head[1:], uint16(n))
+		return head
+	default:
+		head := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(head[1:], uint32(n))
+		return head
+	}
+}
+
+// encodeCBOR covers the types an authenticator puts in an attestation object or a COSE key.
+func encodeCBOR(value interface{}) []byte {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return encodeCBORHead(1, uint64(-1-v))
+		}
+		return encodeCBORHead(0, uint64(v))
+	case []byte:
+		return append(encodeCBORHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeCBORHead(3, uint64(len(v))), v...)
+	case []cborPair:
+		out := encodeCBORHead(5, uint64(len(v)))
+		for _, pair := range v {
+			out = append(out, encodeCBOR(pair.key)...)
+			out = append(out, encodeCBOR(pair.value)...)
+		}
+		return out
+	}
+	panic("unsupported CBOR value")
+}
+
+// softAuthenticator is an ES256 authenticator held in memory, standing in for a security key or platform passkey.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+	flags        byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 16)
+	if _, err := rand.Read(credentialId); err != nil {
+		t.Fatal(err)
+	}
+	return &softAuthenticator{
+		key:          key,
+		credentialId: credentialId,
+		flags:        authDataFlagUserPresent | authDataFlagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	a.key.X.FillBytes(x)
+	a.key.Y.FillBytes(y)
+	return encodeCBOR([]cborPair{
+		{int64(1), int64(2)},
+		{int64(3), COSEAlgES256},
+		{int64(-1), int64(1)},
+		{int64(-2), x},
+		{int64(-3), y},
+	})
+}
+
+func (a *softAuthenticator) authData(rpId string, attested bool) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	data := append([]byte{}, rpIdHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= authDataFlagAttested
+	}
+	data = append(data, flags, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[33:37], a.signCount)
+	if !attested {
+		return data
+	}
+
+	data = append(data, make([]byte, 16)...)
+	data = append(data, byte(len(a.credentialId)>>8), byte(len(a.credentialId)))
+	data = append(data, a.credentialId...)
+	return append(data, a.coseKey()...)
+}
+
+func clientDataJSON(t *testing.T, ceremony, challenge, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(ClientData{Type: ceremony, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// register answers navigator.credentials.create() with "none" attestation.
+func (a *softAuthenticator) register(t *testing.T, challenge, origin string) ([]byte, []byte) {
+	t.Helper()
+	attestationObject := encodeCBOR([]cborPair{
+		{"fmt", "none"},
+		{"attStmt", []cborPair{}},
+		{"authData", a.authData("localhost", true)},
+	})
+	return clientDataJSON(t, webAuthnTypeCreate, challenge, origin), attestationObject
+}
+
+// assert answers navigator.credentials.get(), bumping the counter first like a real authenticator.
+func (a *softAuthenticator) assert(t *testing.T, challenge, origin string) ([]byte, []byte, []byte) {
+	t.Helper()
+	a.signCount++
+	clientData := clientDataJSON(t, webAuthnTypeGet, challenge, origin)
+	authData := a.authData("localhost", false)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientData, authData, signature
+}
+
+func registerSoftAuthenticator(t *testing.T, rp RelyingParty, authenticator *softAuthenticator) *WebAuthnCredential {
+	t.Helper()
+	clientData, attestationObject := authenticator.register(t, "register-challenge", testOrigin)
+	credential, err := rp.VerifyRegistration("register-challenge", clientData, attestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+	return credential
+}
+
+func TestWebAuthnRoundTrip(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t)
+
+	credential := registerSoftAuthenticator(t, rp, authenticator)
+	if !bytes.Equal(credential.Id, authenticator.credentialId) {
+		t.Fatalf("credential id = %x, want %x", credential.Id, authenticator.credentialId)
+	}
+	if credential.Algorithm != COSEAlgES256 || !credential.UserVerified {
+		t.Fatalf("credential = %+v, want ES256 and user verified", credential)
+	}
+
+	storedSignCount := credential.SignCount
+	for i := 0; i < 2; i++ {
+		clientData, authData, signature := authenticator.assert(t, "login-challenge", testOrigin)
+		assertion, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, storedSignCount)
+		if err != nil {
+			t.Fatalf("VerifyAssertion #%d: %v", i+1, err)
+		}
+		if assertion.SignCount != authenticator.signCount {
+			t.Fatalf("sign count = %d, want %d", assertion.SignCount, authenticator.signCount)
+		}
+		storedSignCount = assertion.SignCount
+	}
+
+	clientData, authData, signature := authenticator.assert(t, "login-challenge", testOrigin)
+	signature[len(signature)-1] ^= 0xff
+	_, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, storedSignCount)
+	if !errors.Is(err, ErrWebAuthnSignature) {
+		t.Fatalf("tampered signature: err = %v, want %v", err, ErrWebAuthnSignature)
+	}
+}
+
+func TestWebAuthnSignCount(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t)
+	credential := registerSoftAuthenticator(t, rp, authenticator)
+
+	tests := []struct {
+		name      string
+		counter   uint32
+		stored    uint32
+		wantError error
+	}{
+		{"increased", 6, 5, nil},
+		{"repeated", 5, 5, ErrWebAuthnSignCount},
+		{"went backwards", 2, 5, ErrWebAuthnSignCount},
+		{"reset to zero", 0, 5, ErrWebAuthnSignCount},
+		{"authenticator without a counter", 0, 0, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// assert increments before signing; for a counter of 0 this wraps around from MaxUint32
+			authenticator.signCount = test.counter - 1
+			clientData, authData, signature := authenticator.assert(t, "login-challenge", testOrigin)
+			_, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, test.stored)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("err = %v, want %v", err, test.wantError)
+			}
+		})
+	}
+}
+
+func TestWebAuthnOriginMismatch(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t)
+
+	clientData, attestationObject := authenticator.register(t, "register-challenge", "https://evil.example")
+	if _, err := rp.VerifyRegistration("register-challenge", clientData, attestationObject); !errors.Is(err, ErrWebAuthnOrigin) {
+		t.Fatalf("registration: err = %v, want %v", err, ErrWebAuthnOrigin)
+	}
+
+	credential := registerSoftAuthenticator(t, rp, authenticator)
+	clientData, authData, signature := authenticator.assert(t, "login-challenge", "http://localhost:8081")
+	_, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, credential.SignCount)
+	if !errors.Is(err, ErrWebAuthnOrigin) {
+		t.Fatalf("assertion: err = %v, want %v", err, ErrWebAuthnOrigin)
+	}
+
+	crossOrigin, _ := json.Marshal(ClientData{Type: webAuthnTypeGet, Challenge: "login-challenge", Origin: testOrigin, CrossOrigin: true})
+	if err := rp.verifyClientData(crossOrigin, webAuthnTypeGet, "login-challenge"); !errors.Is(err, ErrWebAuthnOrigin) {
+		t.Fatalf("cross origin: err = %v, want %v", err, ErrWebAuthnOrigin)
+	}
+}
+
+func TestWebAuthnChallengeMismatch(t *testing.T) {
+	rp := testRelyingParty()
+	authenticator := newSoftAuthenticator(t)
+
+	clientData, attestationObject := authenticator.register(t, "stale-challenge", testOrigin)
+	if _, err := rp.VerifyRegistration("register-challenge", clientData, attestationObject); !errors.Is(err, ErrWebAuthnChallenge) {
+		t.Fatalf("registration: err = %v, want %v", err, ErrWebAuthnChallenge)
+	}
+
+	credential := registerSoftAuthenticator(t, rp, authenticator)
+	clientData, authData, signature := authenticator.assert(t, "stale-challenge", testOrigin)
+	_, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, credential.SignCount)
+	if !errors.Is(err, ErrWebAuthnChallenge) {
+		t.Fatalf("assertion: err = %v, want %v", err, ErrWebAuthnChallenge)
+	}
+
+	// a registration response can't be replayed as a login
+	clientData, _ = authenticator.register(t, "login-challenge", testOrigin)
+	_, err = rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, credential.SignCount)
+	if !errors.Is(err, ErrWebAuthnType) {
+		t.Fatalf("ceremony type: err = %v, want %v", err, ErrWebAuthnType)
+	}
+}
+
+func TestWebAuthnUserVerification(t *testing.T) {
+	tests := []struct {
+		name      string
+		requireUV bool
+		flags     byte
+		wantError error
+	}{
+		{"required and verified", true, authDataFlagUserPresent | authDataFlagUserVerified, nil},
+		{"required but only present", true, authDataFlagUserPresent, ErrWebAuthnVerification},
+		{"optional and only present", false, authDataFlagUserPresent, nil},
+		{"not even present", false, 0, ErrWebAuthnUserPresence},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rp := testRelyingParty()
+			rp.RequireUserVerification = test.requireUV
+
+			// register with a fully verified authenticator so only the flags under test differ
+			authenticator := newSoftAuthenticator(t)
+			credential := registerSoftAuthenticator(t, testRelyingParty(), authenticator)
+
+			authenticator.flags = test.flags
+			clientData, attestationObject := authenticator.register(t, "register-challenge", testOrigin)
+			registered, err := rp.VerifyRegistration("register-challenge", clientData, attestationObject)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("registration: err = %v, want %v", err, test.wantError)
+			}
+
+			clientData, authData, signature := authenticator.assert(t, "login-challenge", testOrigin)
+			assertion, err := rp.VerifyAssertion("login-challenge", clientData, authData, signature, credential.PublicKey, credential.SignCount)
+			if !errors.Is(err, test.wantError) {
+				t.Fatalf("assertion: err = %v, want %v", err, test.wantError)
+			}
+
+			if test.wantError == nil {
+				wantVerified := test.flags&authDataFlagUserVerified != 0
+				if registered.UserVerified != wantVerified || assertion.UserVerified != wantVerified {
+					t.Fatalf("user verified = %v/%v, want %v", registered.UserVerified, assertion.UserVerified, wantVerified)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCOSEKeyRSAExponent(t *testing.T) {
+	modulus := make([]byte, 256)
+	if _, err := rand.Read(modulus); err != nil {
+		t.Fatal(err)
+	}
+	modulus[0] |= 0x80
+	modulus[len(modulus)-1] |= 0x01
+
+	tests := []struct {
+		name     string
+		modulus  []byte
+		exponent []byte
+		valid    bool
+	}{
+		{"65537", modulus, []byte{0x01, 0x00, 0x01}, true},
+		{"3", modulus, []byte{0x03}, true},
+		{"empty", modulus, []byte{}, false},
+		{"zero", modulus, []byte{0x00}, false},
+		{"one", modulus, []byte{0x01}, false},
+		{"even", modulus, []byte{0x01, 0x00, 0x00}, false},
+		{"larger than int32", modulus, []byte{0x80, 0x00, 0x00, 0x01}, false},
+		{"longer than four bytes", modulus, []byte{0x00, 0x00, 0x01, 0x00, 0x01}, false},
+		{"modulus padded with zeros", append(make([]byte, 128), modulus[:128]...), []byte{0x01, 0x00, 0x01}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key := encodeCBOR([]cborPair{
+				{int64(1), int64(3)},
+				{int64(3), COSEAlgRS256},
+				{int64(-1), test.modulus},
+				{int64(-2), test.exponent},
+			})
+			_, _, err := parseCOSEKey(key)
+			if test.valid && err != nil {
+				t.Fatalf("err = %v, want the key to be accepted", err)
+			}
+			if !test.valid && !errors.Is(err, ErrWebAuthnPublicKey) {
+				t.Fatalf("err = %v, want %v", err, ErrWebAuthnPublicKey)
+			}
+		})
+	}
+}
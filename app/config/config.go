@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get returns the value of the environment variable named by key, or def when it is unset or empty.
+func Get(key, def string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// Duration parses the environment variable named by key as a time.Duration (e.g. "15m", "720h").
+func Duration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(Get(key, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// Int parses the environment variable named by key as an integer.
+func Int(key string, def int) int {
+	value, err := strconv.Atoi(Get(key, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// Bool parses the environment variable named by key as a boolean.
+func Bool(key string, def bool) bool {
+	value, err := strconv.ParseBool(Get(key, ""))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// List splits the environment variable named by key on commas, dropping empty items.
+func List(key string, def []string) []string {
+	value := Get(key, "")
+	if value == "" {
+		return def
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,159 @@
+package limiter
+
+import (
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+// Policy decides how long a key is blocked after failed attempts. The first FreeAttempts
+// failures cost nothing, then each failure doubles the delay starting at BaseDelay up to
+// MaxDelay, and reaching LockoutThreshold locks the key for LockoutDuration.
+type Policy struct {
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Window is how long a failure is remembered when no other failure follows it.
+	Window time.Duration
+}
+
+// RetryAfter returns how long the key in state has to wait before the next attempt, or zero.
+func (policy Policy) RetryAfter(state State, now time.Time) time.Duration {
+	if state.Failures == 0 || now.Sub(state.LastFailureAt) > policy.Window {
+		return 0
+	}
+
+	var delay time.Duration
+	switch {
+	case state.Failures >= policy.LockoutThreshold:
+		delay = policy.LockoutDuration
+	case state.Failures > policy.FreeAttempts:
+		delay = policy.BaseDelay
+		for i := policy.FreeAttempts + 1; i < state.Failures && delay < policy.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+
+	if wait := state.LastFailureAt.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// LoginLimiter tracks failed logins per account and per client IP.
+type LoginLimiter struct {
+	store         Store
+	accountPolicy Policy
+	ipPolicy      Policy
+	// prefix keeps the counters of limiters sharing a store apart
+	prefix string
+}
+
+func NewLoginLimiter(store Store, accountPolicy, ipPolicy Policy) *LoginLimiter {
+	return &LoginLimiter{
+		store:         store,
+		accountPolicy: accountPolicy,
+		ipPolicy:      ipPolicy,
+	}
+}
+
+// NewLoginLimiterFromEnv builds the limiter from the LOGIN_* settings.
+func NewLoginLimiterFromEnv(store Store) *LoginLimiter {
+	window := config.Duration("LOGIN_ATTEMPT_WINDOW", time.Hour)
+	accountPolicy := Policy{
+		FreeAttempts:     config.Int("LOGIN_FREE_ATTEMPTS", 3),
+		BaseDelay:        config.Duration("LOGIN_BASE_DELAY", time.Second),
+		MaxDelay:         config.Duration("LOGIN_MAX_DELAY", 5*time.Minute),
+		LockoutThreshold: config.Int("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LockoutDuration:  config.Duration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:           window,
+	}
+
+	// many users can share one address, so an IP gets more room before it is slowed down
+	ipPolicy := accountPolicy
+	ipPolicy.FreeAttempts = config.Int("LOGIN_IP_FREE_ATTEMPTS", 20)
+	ipPolicy.LockoutThreshold = config.Int("LOGIN_IP_LOCKOUT_THRESHOLD", 100)
+
+	return NewLoginLimiter(store, accountPolicy, ipPolicy)
+}
+
+// NewMagicLinkLimiterFromEnv builds the limiter for magic link emails from the MAGIC_LINK_* settings.
+// Every request counts as an attempt, whether or not the email is registered, so being throttled
+// says nothing about the account.
+func NewMagicLinkLimiterFromEnv(store Store) *LoginLimiter {
+	window := config.Duration("MAGIC_LINK_ATTEMPT_WINDOW", time.Hour)
+	emailPolicy := Policy{
+		FreeAttempts:     config.Int("MAGIC_LINK_FREE_ATTEMPTS", 3),
+		BaseDelay:        config.Duration("MAGIC_LINK_BASE_DELAY", time.Minute),
+		MaxDelay:         config.Duration("MAGIC_LINK_MAX_DELAY", 15*time.Minute),
+		LockoutThreshold: config.Int("MAGIC_LINK_LOCKOUT_THRESHOLD", 10),
+		LockoutDuration:  config.Duration("MAGIC_LINK_LOCKOUT_DURATION", time.Hour),
+		Window:           window,
+	}
+
+	ipPolicy := emailPolicy
+	ipPolicy.FreeAttempts = config.Int("MAGIC_LINK_IP_FREE_ATTEMPTS", 10)
+	ipPolicy.LockoutThreshold = config.Int("MAGIC_LINK_IP_LOCKOUT_THRESHOLD", 50)
+
+	limiter := NewLoginLimiter(store, emailPolicy, ipPolicy)
+	limiter.prefix = "magic_link:"
+	return limiter
+}
+
+// Check returns how long the caller must wait before trying account from ip again, or zero.
+func (limiter *LoginLimiter) Check(account, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	accountState, err := limiter.store.Get(limiter.accountKey(account))
+	if err != nil {
+		return 0, err
+	}
+	ipState, err := limiter.store.Get(limiter.ipKey(ip))
+	if err != nil {
+		return 0, err
+	}
+
+	return longest(limiter.accountPolicy.RetryAfter(accountState, now), limiter.ipPolicy.RetryAfter(ipState, now)), nil
+}
+
+// Fail records a failed attempt and returns how long the caller must now wait.
+func (limiter *LoginLimiter) Fail(account, ip string) (time.Duration, error) {
+	now := time.Now()
+
+	accountState, err := limiter.store.RecordFailure(limiter.accountKey(account), limiter.accountPolicy.Window)
+	if err != nil {
+		return 0, err
+	}
+	ipState, err := limiter.store.RecordFailure(limiter.ipKey(ip), limiter.ipPolicy.Window)
+	if err != nil {
+		return 0, err
+	}
+
+	return longest(limiter.accountPolicy.RetryAfter(accountState, now), limiter.ipPolicy.RetryAfter(ipState, now)), nil
+}
+
+// Succeed clears the account counter. The IP counter is left alone so one valid account
+// can't be used to reset the budget of an address that is guessing other accounts.
+func (limiter *LoginLimiter) Succeed(account string) error {
+	return limiter.store.Reset(limiter.accountKey(account))
+}
+
+func (limiter *LoginLimiter) accountKey(account string) string {
+	return limiter.prefix + "account:" + account
+}
+
+func (limiter *LoginLimiter) ipKey(ip string) string {
+	return limiter.prefix + "ip:" + ip
+}
+
+func longest(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,57 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps counters in process memory. Counters are lost on restart and are not
+// shared between instances.
+type MemoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: map[string]State{},
+	}
+}
+
+func (store *MemoryStore) Get(key string) (State, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return store.states[key], nil
+}
+
+func (store *MemoryStore) RecordFailure(key string, window time.Duration) (State, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	state := store.states[key]
+	if now.Sub(state.LastFailureAt) > window {
+		state.Failures = 0
+	}
+	state.Failures++
+	state.LastFailureAt = now
+	store.states[key] = state
+
+	// opportunistically drop stale keys so the map doesn't grow forever
+	for otherKey, other := range store.states {
+		if now.Sub(other.LastFailureAt) > window {
+			delete(store.states, otherKey)
+		}
+	}
+
+	return state, nil
+}
+
+func (store *MemoryStore) Reset(key string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.states, key)
+	return nil
+}
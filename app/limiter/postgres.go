@@ -0,0 +1,65 @@
+package limiter
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresStore keeps counters in the login_throttles table so they are shared by every instance.
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{
+		db: db,
+	}
+}
+
+func (store *PostgresStore) Get(key string) (State, error) {
+	var throttle models.LoginThrottle
+	err := store.db.Where("key = ?", key).Take(&throttle).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return State{}, nil
+		}
+		return State{}, err
+	}
+
+	return State{Failures: throttle.Failures, LastFailureAt: throttle.LastFailureAt}, nil
+}
+
+func (store *PostgresStore) RecordFailure(key string, window time.Duration) (State, error) {
+	now := time.Now()
+	throttle := models.LoginThrottle{
+		Key:           key,
+		Failures:      1,
+		LastFailureAt: now,
+	}
+
+	// a single upsert keeps concurrent failures from different instances from losing counts
+	err := store.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", now.Add(-window)),
+				"last_failure_at": now,
+				"updated_at":      now,
+			}),
+		},
+		clause.Returning{},
+	).Create(&throttle).Error
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{Failures: throttle.Failures, LastFailureAt: throttle.LastFailureAt}, nil
+}
+
+func (store *PostgresStore) Reset(key string) error {
+	return store.db.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
@@ -0,0 +1,19 @@
+package limiter
+
+import "time"
+
+// State is what a Store remembers about a key.
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+}
+
+// Store persists failed attempt counters. Use the Postgres store when running more than one
+// instance so every instance sees the same counters.
+type Store interface {
+	Get(key string) (State, error)
+	// RecordFailure increments the counter of key, starting over when the previous failure
+	// is older than window, and returns the new state.
+	RecordFailure(key string, window time.Duration) (State, error)
+	Reset(key string) error
+}
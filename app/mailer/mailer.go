@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as password reset links.
+type Mailer interface {
+	Send(message Message) error
+}
+
+// NewFromEnv picks the mailer from MAIL_DRIVER: "smtp", or "outbox" for local development.
+// There is no default, so a deployment that forgets the setting fails at startup instead of
+// quietly writing every email to disk.
+func NewFromEnv() (Mailer, error) {
+	from := config.Get("MAIL_FROM", "MyGRAM <no-reply@mygram.local>")
+
+	switch driver := config.Get("MAIL_DRIVER", ""); driver {
+	case "smtp":
+		return &SMTPMailer{
+			Host:     config.Get("SMTP_HOST", "localhost"),
+			Port:     config.Get("SMTP_PORT", "587"),
+			Username: config.Get("SMTP_USERNAME", ""),
+			Password: config.Get("SMTP_PASSWORD", ""),
+			From:     from,
+		}, nil
+	case "outbox":
+		return NewOutboxMailer(config.Get("MAIL_OUTBOX_DIR", "outbox"), from)
+	case "":
+		return nil, errors.New("MAIL_DRIVER is not set, use smtp (or outbox for local development)")
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OutboxMailer writes every message as an .eml file into Dir instead of sending it.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+func NewOutboxMailer(dir, from string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &OutboxMailer{
+		Dir:  dir,
+		From: from,
+	}, nil
+}
+
+func (mailer *OutboxMailer) Send(message Message) error {
+	recipient := strings.NewReplacer("@", "_at_", "/", "_").Replace(message.To)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	return os.WriteFile(filepath.Join(mailer.Dir, name), render(mailer.From, message), 0o600)
+}
@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPMailer sends email through an SMTP relay, authenticating with PLAIN when a username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (mailer *SMTPMailer) Send(message Message) error {
+	from, err := mail.ParseAddress(mailer.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if mailer.Username != "" {
+		auth = smtp.PlainAuth("", mailer.Username, mailer.Password, mailer.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%s", mailer.Host, mailer.Port)
+	return smtp.SendMail(addr, auth, from.Address, []string{message.To}, render(mailer.From, message))
+}
+
+func render(from string, message Message) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + message.Subject + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+	return []byte(builder.String())
+}
@@ -1,15 +1,19 @@
 package middleware
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
 )
 
-func Auth() gin.HandlerFunc {
+// Auth authenticates either a bearer access token or an "ApiKey" personal key. Bearer tokens
+// revoked through revocations, or whose session was terminated, are rejected.
+func Auth(revocations *repository.RevocationStore, apiKeys *repository.ApiKeyStore, sessions *repository.SessionStore) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		headerToken := ctx.Request.Header.Get("Authorization")
 		if headerToken == "" {
@@ -20,7 +24,12 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
-		bearer := strings.HasPrefix(headerToken, "Bearer")
+		if strings.HasPrefix(headerToken, "ApiKey ") {
+			authenticateApiKey(ctx, apiKeys, strings.TrimPrefix(headerToken, "ApiKey "))
+			return
+		}
+
+		bearer := strings.HasPrefix(headerToken, "Bearer ")
 		if !bearer {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   true,
@@ -29,20 +38,102 @@ func Auth() gin.HandlerFunc {
 			return
 		}
 
-		bearerToken := strings.Split(headerToken, "Bearer ")[1]
+		bearerToken := strings.TrimPrefix(headerToken, "Bearer ")
+
+		data, err := auth.VerifyToken(bearerToken)
+		if err != nil {
+			if errors.Is(err, auth.ErrTokenExpired) {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error":   true,
+					"code":    "token_expired",
+					"message": err.Error(),
+				})
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "token_invalid",
+				"message": err.Error(),
+			})
+			return
+		}
 
-		verify, err := auth.VerifyToken(bearerToken)
+		principal, err := auth.PrincipalFromClaims(data)
 		if err != nil {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "token_invalid",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		revoked, err := revocations.IsRevoked(principal.TokenId, principal.UserId, auth.ClaimTime(data, "iat"))
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":   true,
+				"message": err.Error(),
+			})
+			return
+		}
+		if revoked {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "token_revoked",
+				"message": "token has been revoked",
+			})
+			return
+		}
+
+		active, err := sessions.Active(principal.SessionId)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 				"error":   true,
 				"message": err.Error(),
 			})
 			return
 		}
-		data := verify.(jwt.MapClaims)
+		if !active {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "session_terminated",
+				"message": "session has been terminated",
+			})
+			return
+		}
+		if err := sessions.Touch(principal.SessionId, ctx.ClientIP()); err != nil {
+			log.Println("session last seen:", err)
+		}
 
-		ctx.Set("id", data["id"])
-		ctx.Set("email", data["email"])
+		setPrincipal(ctx, principal)
 		ctx.Next()
 	}
 }
+
+func authenticateApiKey(ctx *gin.Context, apiKeys *repository.ApiKeyStore, key string) {
+	apiKey, err := apiKeys.Authenticate(key)
+	if err != nil {
+		if errors.Is(err, repository.ErrApiKeyInvalid) {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "api_key_invalid",
+				"message": err.Error(),
+			})
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":   true,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	setPrincipal(ctx, auth.Principal{
+		UserId: apiKey.UserId,
+		Email:  apiKey.User.Email,
+		Roles:  apiKey.User.Roles(),
+		Scopes: auth.SplitScopes(apiKey.Scopes),
+		Method: auth.AuthMethodApiKey,
+	})
+	ctx.Next()
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	auth.SetKeyring(auth.NewKeyring(&auth.SigningKey{
+		Id:        "test",
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   []byte("middleware-test-secret"),
+		VerifyKey: []byte("middleware-test-secret"),
+	}))
+}
+
+// accessClaims are the claims GenerateToken would put in a token, for the cases below to break one at a time.
+func accessClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"id":    1,
+		"email": "user@example.com",
+		"roles": []string{"user"},
+		"typ":   auth.TokenTypeAccess,
+		"sid":   "session",
+		"jti":   "token",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Minute).Unix(),
+	}
+}
+
+func TestAuthRejectsMalformedClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(claims jwt.MapClaims)
+	}{
+		{"id is a string", func(claims jwt.MapClaims) { claims["id"] = "1" }},
+		{"id is missing", func(claims jwt.MapClaims) { delete(claims, "id") }},
+		{"id is zero", func(claims jwt.MapClaims) { claims["id"] = 0 }},
+		{"id is negative", func(claims jwt.MapClaims) { claims["id"] = -1 }},
+		{"id is fractional", func(claims jwt.MapClaims) { claims["id"] = 1.5 }},
+		{"id is larger than uint32", func(claims jwt.MapClaims) { claims["id"] = uint64(1) << 32 }},
+		{"sid is missing", func(claims jwt.MapClaims) { delete(claims, "sid") }},
+		{"sid is empty", func(claims jwt.MapClaims) { claims["sid"] = "" }},
+		{"sid is a number", func(claims jwt.MapClaims) { claims["sid"] = 7 }},
+		{"jti is missing", func(claims jwt.MapClaims) { delete(claims, "jti") }},
+		{"jti is empty", func(claims jwt.MapClaims) { claims["jti"] = "" }},
+		{"email is not a string", func(claims jwt.MapClaims) { claims["email"] = 42 }},
+	}
+
+	// no Recovery middleware, so a panic fails the test instead of turning into a 500;
+	// the stores are nil because a rejected token must never reach them
+	router := gin.New()
+	router.GET("/protected", Auth(nil, nil, nil), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			claims := accessClaims()
+			test.mutate(claims)
+			token, err := auth.DefaultKeyring().Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the signature is valid, so only the claims themselves can be what Auth rejects
+			if _, err := auth.VerifyToken(token); err != nil {
+				t.Fatalf("VerifyToken: %v", err)
+			}
+
+			request := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			request.Header.Set("Authorization", "Bearer "+token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != "token_invalid" {
+				t.Fatalf("code = %q, want %q", body.Code, "token_invalid")
+			}
+		})
+	}
+}
+
+func TestCurrentPrincipalWithoutAuth(t *testing.T) {
+	var principal auth.Principal
+	var err error
+
+	router := gin.New()
+	router.GET("/public", func(ctx *gin.Context) {
+		principal, err = CurrentPrincipal(ctx)
+		ctx.Status(http.StatusOK)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public", nil))
+
+	if !errors.Is(err, ErrNoPrincipal) {
+		t.Fatalf("err = %v, want %v", err, ErrNoPrincipal)
+	}
+	if principal.UserId != 0 {
+		t.Fatalf("principal = %+v, want the zero value", principal)
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+)
+
+const principalKey = "principal"
+
+// ErrNoPrincipal is returned when a handler asks for the caller on a route that Auth did not run on.
+var ErrNoPrincipal = errors.New("request is not authenticated")
+
+// CurrentPrincipal returns the caller that Auth authenticated.
+func CurrentPrincipal(ctx *gin.Context) (auth.Principal, error) {
+	value, exists := ctx.Get(principalKey)
+	if !exists {
+		return auth.Principal{}, ErrNoPrincipal
+	}
+	principal, ok := value.(auth.Principal)
+	if !ok || principal.UserId == 0 {
+		return auth.Principal{}, ErrNoPrincipal
+	}
+	return principal, nil
+}
+
+func setPrincipal(ctx *gin.Context, principal auth.Principal) {
+	ctx.Set(principalKey, principal)
+}
+
+func abortUnauthenticated(ctx *gin.Context) {
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error":   true,
+		"message": "UNAUTHORIZED",
+	})
+}
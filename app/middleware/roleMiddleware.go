@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users holding at least one of roles. It must run after Auth.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, err := CurrentPrincipal(ctx)
+		if err != nil {
+			abortUnauthenticated(ctx)
+			return
+		}
+
+		if !principal.HasRole(roles...) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   true,
+				"message": "FORBIDDEN",
+			})
+			return
+		}
+
+		ctx.Next()
+	}
+}
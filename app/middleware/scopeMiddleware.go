@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope rejects API keys that were not granted scope. Interactive logins hold every
+// scope. It must run after Auth.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		principal, err := CurrentPrincipal(ctx)
+		if err != nil {
+			abortUnauthenticated(ctx)
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   true,
+				"code":    "insufficient_scope",
+				"message": "this credential is missing the " + scope + " scope",
+			})
+			return
+		}
+
+		ctx.Next()
+	}
+}
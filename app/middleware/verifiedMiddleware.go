@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+// RequireVerifiedEmail blocks users who have not verified their email yet. The policy can be
+// switched off with REQUIRE_VERIFIED_EMAIL=false. It must run after Auth.
+func RequireVerifiedEmail(db *gorm.DB) gin.HandlerFunc {
+	required := config.Bool("REQUIRE_VERIFIED_EMAIL", true)
+
+	return func(ctx *gin.Context) {
+		if !required {
+			ctx.Next()
+			return
+		}
+
+		principal, err := CurrentPrincipal(ctx)
+		if err != nil {
+			abortUnauthenticated(ctx)
+			return
+		}
+
+		var user models.User
+		err = db.Select("id", "email_verified_at").First(&user, principal.UserId).Error
+		if err != nil {
+			abortUnauthenticated(ctx)
+			return
+		}
+
+		if user.EmailVerifiedAt == nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   true,
+				"code":    "email_unverified",
+				"message": "please verify your email before posting",
+			})
+			return
+		}
+
+		ctx.Next()
+	}
+}
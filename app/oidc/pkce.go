@@ -0,0 +1,19 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+)
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636), 43 characters long.
+func NewCodeVerifier() (string, error) {
+	return auth.GenerateOpaqueToken(32)
+}
+
+// CodeChallengeS256 derives the S256 code challenge sent in the authorization request.
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
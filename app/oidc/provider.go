@@ -0,0 +1,267 @@
+package oidc
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+)
+
+var ErrNotConfigured = errors.New("OpenID Connect login is not configured")
+
+// Provider is an external OpenID Connect provider used with the authorization code flow and PKCE.
+// Endpoints are discovered from Issuer on first use, so a local mock provider works as well
+// as a hosted one.
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+// Claims are the ID token claims MyGRAM uses.
+type Claims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// NewProviderFromEnv reads OIDC_* settings. It returns nil when OIDC_ISSUER is unset.
+func NewProviderFromEnv() *Provider {
+	issuer := config.Get("OIDC_ISSUER", "")
+	if issuer == "" {
+		return nil
+	}
+
+	return &Provider{
+		Name:         config.Get("OIDC_PROVIDER_NAME", "oidc"),
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientId:     config.Get("OIDC_CLIENT_ID", ""),
+		ClientSecret: config.Get("OIDC_CLIENT_SECRET", ""),
+		RedirectURL:  config.Get("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+		Scopes:       config.List("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthCodeURL builds the URL the user is sent to in order to authenticate with the provider.
+func (provider *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientId)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID token claims.
+func (provider *Provider) Exchange(code, codeVerifier, nonce string) (*Claims, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("client_id", provider.ClientId)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.ClientId), url.QueryEscape(provider.ClientSecret))
+	}
+
+	res, err := provider.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var tokenResponse struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if res.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		return nil, fmt.Errorf("token endpoint: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IdToken == "" {
+		return nil, errors.New("token endpoint did not return an id_token")
+	}
+
+	return provider.VerifyIDToken(tokenResponse.IdToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token.
+func (provider *Provider) VerifyIDToken(rawIDToken, nonce string) (*Claims, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, provider.keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}))
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+
+	if claims.Issuer != discovery.Issuer {
+		return nil, fmt.Errorf("id token: unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(provider.ClientId, true) {
+		return nil, errors.New("id token: audience does not match client id")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("id token: missing exp")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token: nonce does not match")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token: missing sub")
+	}
+
+	return claims, nil
+}
+
+func (provider *Provider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	key, err := provider.key(kid, false)
+	if err == nil {
+		return key, nil
+	}
+	// the provider may have rotated its keys since they were cached
+	return provider.key(kid, true)
+}
+
+func (provider *Provider) key(kid string, refresh bool) (crypto.PublicKey, error) {
+	discovery, err := provider.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.keys == nil || (refresh && time.Since(provider.keysAt) > time.Minute) {
+		var set jsonWebKeySet
+		if err := provider.getJSON(discovery.JwksURI, &set); err != nil {
+			return nil, err
+		}
+
+		keys := map[string]crypto.PublicKey{}
+		for _, jwk := range set.Keys {
+			if jwk.Use != "" && jwk.Use != "sig" {
+				continue
+			}
+			publicKey, err := jwk.publicKey()
+			if err != nil {
+				continue
+			}
+			keys[jwk.Kid] = publicKey
+		}
+		provider.keys = keys
+		provider.keysAt = time.Now()
+	}
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+	// providers with a single key often omit kid
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (provider *Provider) discover() (*discoveryDocument, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	var discovery discoveryDocument
+	if err := provider.getJSON(provider.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != provider.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, provider.Issuer)
+	}
+
+	provider.discovery = &discovery
+	return provider.discovery, nil
+}
+
+func (provider *Provider) getJSON(endpoint string, target interface{}) error {
+	res, err := provider.client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", endpoint, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
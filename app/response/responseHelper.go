@@ -1,7 +1,10 @@
 package response
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,3 +40,24 @@ func UnauthorizedResponse(ctx *gin.Context, payload interface{}) {
 		"message": payload,
 	})
 }
+
+func TooManyRequestsResponse(ctx *gin.Context, retryAfter time.Duration, payload interface{}) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	ctx.Header("Retry-After", strconv.Itoa(seconds))
+	WriteJsonResponse(ctx, http.StatusTooManyRequests, gin.H{
+		"error":       true,
+		"code":        "too_many_attempts",
+		"message":     payload,
+		"retry_after": seconds,
+	})
+}
+
+// ValidationErrorResponse reports every problem per request field, e.g. {"password": ["...", "..."]}.
+func ValidationErrorResponse(ctx *gin.Context, fields map[string][]string) {
+	WriteJsonResponse(ctx, http.StatusBadRequest, gin.H{
+		"error":   true,
+		"code":    "validation_failed",
+		"message": "some fields are invalid",
+		"fields":  fields,
+	})
+}
@@ -0,0 +1,69 @@
+// Command timeline-backfill rebuilds the materialized home feed timelines. It first fans out the
+// photos that are still waiting, e.g. after the queue overflowed or FEED_MODE was switched from
+// pull, and then rebuilds the timeline of one user (-user) or of every user.
+//
+//	go run ./cmd/timeline-backfill -since 720h
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/database"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+)
+
+func main() {
+	since := flag.Duration("since", 0, "only consider photos created within this long; 0 means all photos")
+	userId := flag.Uint("user", 0, "rebuild only this user's timeline")
+	flag.Parse()
+
+	db := database.ConnectDB()
+	timelines := repository.NewTimelineStore(db)
+	if !timelines.Enabled() {
+		log.Fatal("FEED_MODE is pull, there are no timelines to build")
+	}
+
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+
+	if *userId != 0 {
+		if err := timelines.Rebuild(*userId, cutoff); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rebuilt the timeline of user %d", *userId)
+		return
+	}
+
+	processed, err := timelines.FanOutPending(cutoff)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("fanned out %d pending photos", processed)
+
+	rebuilt := 0
+	var after uint
+	for {
+		var userIds []uint
+		err := db.Model(&models.User{}).Where("id > ?", after).Order("id").Limit(1000).Pluck("id", &userIds).Error
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(userIds) == 0 {
+			break
+		}
+
+		for _, id := range userIds {
+			if err := timelines.Rebuild(id, cutoff); err != nil {
+				log.Fatal(err)
+			}
+			rebuilt++
+		}
+		after = userIds[len(userIds)-1]
+	}
+	log.Printf("rebuilt %d timelines", rebuilt)
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+)
+
+type ApiKeyController struct {
+	apiKeys *repository.ApiKeyStore
+}
+
+func NewApiKeyController(apiKeys *repository.ApiKeyStore) *ApiKeyController {
+	return &ApiKeyController{
+		apiKeys: apiKeys,
+	}
+}
+
+// CreateApiKey godoc
+// @Summary Create an API key
+// @Description Create a personal API key with the given scopes. The key is only returned in this response.
+// @Tags ApiKeys
+// @Accept json
+// @Produce json
+// @Param apiKey body repository.ApiKeyRequest true "API key data"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.ApiKeyCreateResponse
+// @Router /users/api-keys [post]
+func (controller *ApiKeyController) CreateApiKey(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	apiKeyRequest := repository.ApiKeyRequest{}
+
+	err = ctx.ShouldBindJSON(&apiKeyRequest)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&apiKeyRequest)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if len(apiKeyRequest.Scopes) == 0 {
+		response.BadRequestResponse(ctx, "At least one scope is required")
+		return
+	}
+	for _, scope := range apiKeyRequest.Scopes {
+		if !auth.ValidAPIKeyScope(scope) {
+			response.BadRequestResponse(ctx, "Unknown scope "+scope)
+			return
+		}
+	}
+
+	apiKey, key, err := controller.apiKeys.Create(principal.UserId, apiKeyRequest.Name, apiKeyRequest.Scopes)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusCreated, repository.ApiKeyCreateResponse{
+		ApiKeyResponse: apiKeyResponse(apiKey),
+		Key:            key,
+	})
+}
+
+// FindAllApiKey godoc
+// @Summary List API keys
+// @Description List the API keys of the authenticated user, including revoked ones
+// @Tags ApiKeys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} repository.ApiKeyResponse
+// @Router /users/api-keys [get]
+func (controller *ApiKeyController) FindAllApiKey(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	apiKeys, err := controller.apiKeys.List(principal.UserId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	apiKeyList := make([]repository.ApiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		apiKeyList = append(apiKeyList, apiKeyResponse(apiKey))
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, apiKeyList)
+}
+
+// RevokeApiKey godoc
+// @Summary Revoke an API key
+// @Description Revoke one of the authenticated user's API keys
+// @Tags ApiKeys
+// @Produce json
+// @Param apiKeyId path string true "API key ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/api-keys/{apiKeyId} [delete]
+func (controller *ApiKeyController) RevokeApiKey(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	apiKeyId, err := strconv.ParseUint(ctx.Param("apiKeyId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid API key ID")
+		return
+	}
+
+	revoked, err := controller.apiKeys.Revoke(principal.UserId, uint(apiKeyId))
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if !revoked {
+		response.NotFoundResponse(ctx, "data not found")
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "Your API key has been successfully revoked",
+	})
+}
+
+func apiKeyResponse(apiKey models.ApiKey) repository.ApiKeyResponse {
+	return repository.ApiKeyResponse{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     auth.SplitScopes(apiKey.Scopes),
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BlockController struct {
+	db *gorm.DB
+}
+
+func NewBlockController(db *gorm.DB) *BlockController {
+	return &BlockController{
+		db: db,
+	}
+}
+
+// BlockUser godoc
+// @Summary Block a user
+// @Description Block the user with the given username. Follows and follow requests between you are removed both ways,
+// @Description neither of you sees the other's photos and comments, and you can't follow or comment on each other.
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.RelationResponse
+// @Router /users/{username}/block [post]
+func (controller *BlockController) BlockUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	if target.Id == principal.UserId {
+		response.BadRequestResponse(ctx, "You can't block yourself")
+		return
+	}
+
+	var created int64
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Block{
+			BlockerId: principal.UserId,
+			BlockedId: target.Id,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected
+
+		err := tx.Where("(follower_id = ? AND following_id = ?) OR (follower_id = ? AND following_id = ?)",
+			principal.UserId, target.Id, target.Id, principal.UserId).Delete(&models.Follow{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("(requester_id = ? AND target_id = ?) OR (requester_id = ? AND target_id = ?)",
+			principal.UserId, target.Id, target.Id, principal.UserId).Delete(&models.FollowRequest{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("(user_id = ? AND author_id = ?) OR (user_id = ? AND author_id = ?)",
+			principal.UserId, target.Id, target.Id, principal.UserId).Delete(&models.TimelineEntry{}).Error
+	})
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if created > 0 {
+		status = http.StatusCreated
+	}
+	controller.writeRelationState(ctx, status, principal.UserId, target)
+}
+
+// UnblockUser godoc
+// @Summary Unblock a user
+// @Description Unblock the user with the given username. Removed follows are not restored.
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.RelationResponse
+// @Router /users/{username}/block [delete]
+func (controller *BlockController) UnblockUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	result := controller.db.Where("blocker_id = ? AND blocked_id = ?", principal.UserId, target.Id).Delete(&models.Block{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "You have not blocked this user")
+		return
+	}
+
+	controller.writeRelationState(ctx, http.StatusOK, principal.UserId, target)
+}
+
+// MuteUser godoc
+// @Summary Mute a user
+// @Description Hide the photos of the user with the given username from your feed. They are not told and follows are kept.
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.RelationResponse
+// @Router /users/{username}/mute [post]
+func (controller *BlockController) MuteUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	if target.Id == principal.UserId {
+		response.BadRequestResponse(ctx, "You can't mute yourself")
+		return
+	}
+
+	result := controller.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Mute{
+		MuterId: principal.UserId,
+		MutedId: target.Id,
+	})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusCreated
+	}
+	controller.writeRelationState(ctx, status, principal.UserId, target)
+}
+
+// UnmuteUser godoc
+// @Summary Unmute a user
+// @Description Show the photos of the user with the given username in your feed again
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.RelationResponse
+// @Router /users/{username}/mute [delete]
+func (controller *BlockController) UnmuteUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	result := controller.db.Where("muter_id = ? AND muted_id = ?", principal.UserId, target.Id).Delete(&models.Mute{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "You have not muted this user")
+		return
+	}
+
+	controller.writeRelationState(ctx, http.StatusOK, principal.UserId, target)
+}
+
+func (controller *BlockController) writeRelationState(ctx *gin.Context, status int, viewerId uint, target models.User) {
+	var blocked, muted int64
+	err := controller.db.Model(&models.Block{}).
+		Where("blocker_id = ? AND blocked_id = ?", viewerId, target.Id).
+		Count(&blocked).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	err = controller.db.Model(&models.Mute{}).
+		Where("muter_id = ? AND muted_id = ?", viewerId, target.Id).
+		Count(&muted).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, status, repository.RelationResponse{
+		Username: target.Username,
+		Blocked:  blocked > 0,
+		Muted:    muted > 0,
+	})
+}
@@ -1,10 +1,14 @@
 package controller
 
 import (
+	"database/sql"
 	"net/http"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
@@ -12,12 +16,14 @@ import (
 )
 
 type CommentController struct {
-	db *gorm.DB
+	db        *gorm.DB
+	reactions []string
 }
 
 func NewCommentController(db *gorm.DB) *CommentController {
 	return &CommentController{
-		db: db,
+		db:        db,
+		reactions: config.List("COMMENT_REACTIONS", defaultReactions),
 	}
 }
 
@@ -33,10 +39,15 @@ func NewCommentController(db *gorm.DB) *CommentController {
 // @Success 201 {object} repository.CommentCreateResponse
 // @Router /comments [post]
 func (controller *CommentController) CreateComment(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	commentRequest := repository.CommentRequest{}
 
-	err := ctx.ShouldBindJSON(&commentRequest)
+	err = ctx.ShouldBindJSON(&commentRequest)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
@@ -45,7 +56,7 @@ func (controller *CommentController) CreateComment(ctx *gin.Context) {
 	comment := models.Comment{
 		Message: commentRequest.Message,
 		PhotoId: commentRequest.PhotoId,
-		UserId:  uint(userId.(float64)),
+		UserId:  principal.UserId,
 	}
 
 	_, err = govalidator.ValidateStruct(&comment)
@@ -54,6 +65,11 @@ func (controller *CommentController) CreateComment(ctx *gin.Context) {
 		return
 	}
 
+	// photos of private accounts, and of users blocked either way, look missing
+	if _, ok := findVisiblePhoto(ctx, controller.db, principal, comment.PhotoId); !ok {
+		return
+	}
+
 	err = controller.db.Create(&comment).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
@@ -65,17 +81,20 @@ func (controller *CommentController) CreateComment(ctx *gin.Context) {
 	}
 
 	response.WriteJsonResponse(ctx, http.StatusCreated, repository.CommentCreateResponse{
-		Id:        comment.Id,
-		Message:   comment.Message,
-		PhotoId:   comment.PhotoId,
-		UserId:    comment.UserId,
-		CreatedAt: comment.CreatedAt,
+		Id:          comment.Id,
+		Message:     comment.Message,
+		PhotoId:     comment.PhotoId,
+		UserId:      comment.UserId,
+		Reactions:   []repository.ReactionCount{},
+		MyReactions: []string{},
+		CreatedAt:   comment.CreatedAt,
 	})
 }
 
 // FindAllComment godoc
 // @Summary Get all comments
-// @Description Get all comments
+// @Description Get all comments, leaving out those on photos of private accounts the user doesn't follow
+// @Description and those by or under photos of users blocked by or blocking the user
 // @Tags Comment
 // @Accept json
 // @Produce json
@@ -83,8 +102,22 @@ func (controller *CommentController) CreateComment(ctx *gin.Context) {
 // @Success 200 {array} repository.CommentCreateResponse
 // @Router /comments [get]
 func (controller *CommentController) FindAllComment(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	viewer := sql.Named("viewer", principal.UserId)
+	query := controller.db.Select("comments.*").
+		Joins("JOIN photos ON photos.id = comments.photo_id").
+		Joins("JOIN users AS owners ON owners.id = photos.user_id").
+		Where(notBlocked("comments.user_id"), viewer).
+		Where(notBlocked("owners.id"), viewer).
+		Where(visibleOwner("owners"), viewer)
+
 	var comments []models.Comment
-	err := controller.db.Find(&comments).Error
+	err = query.Find(&comments).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -105,6 +138,12 @@ func (controller *CommentController) FindAllComment(ctx *gin.Context) {
 		})
 	}
 
+	err = controller.attachReactions(principal.UserId, commentList)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
 	response.WriteJsonResponse(ctx, http.StatusOK, commentList)
 }
 
@@ -120,11 +159,16 @@ func (controller *CommentController) FindAllComment(ctx *gin.Context) {
 // @Success 200 {object} repository.CommentCreateResponse
 // @Router /comment/{commentId} [put]
 func (controller *CommentController) UpdateComment(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	commentId := ctx.Param("commentId")
 	var comment models.Comment
 
-	err := controller.db.First(&comment, commentId).Error
+	err = controller.db.First(&comment, commentId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -134,7 +178,7 @@ func (controller *CommentController) UpdateComment(ctx *gin.Context) {
 		return
 	}
 
-	if comment.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionUpdate, auth.ResourceComment, comment.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to update this comment",
@@ -168,13 +212,20 @@ func (controller *CommentController) UpdateComment(ctx *gin.Context) {
 		return
 	}
 
-	response.WriteJsonResponse(ctx, http.StatusOK, repository.CommentCreateResponse{
+	updated := []repository.CommentCreateResponse{{
 		Id:        comment.Id,
 		Message:   comment.Message,
 		PhotoId:   comment.PhotoId,
 		UserId:    comment.UserId,
 		CreatedAt: comment.CreatedAt,
-	})
+	}}
+	err = controller.attachReactions(principal.UserId, updated)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, updated[0])
 }
 
 // DeleteComment godoc
@@ -188,11 +239,16 @@ func (controller *CommentController) UpdateComment(ctx *gin.Context) {
 // @Success 200 {object} gin.H
 // @Router /comments/{commentId} [delete]
 func (controller *CommentController) DeleteComment(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	commentId := ctx.Param("commentId")
 	var comment models.Comment
 
-	err := controller.db.First(&comment, commentId).Error
+	err = controller.db.First(&comment, commentId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -202,7 +258,7 @@ func (controller *CommentController) DeleteComment(ctx *gin.Context) {
 		return
 	}
 
-	if comment.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionDelete, auth.ResourceComment, comment.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to delete this comment",
@@ -210,12 +266,13 @@ func (controller *CommentController) DeleteComment(ctx *gin.Context) {
 		return
 	}
 
-	err = controller.db.Delete(&comment).Error
-	if err != nil {
-		if err.Error() == gorm.ErrRecordNotFound.Error() {
-			response.NotFoundResponse(ctx, err.Error())
-			return
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("comment_id = ?", comment.Id).Delete(&models.CommentReaction{}).Error; err != nil {
+			return err
 		}
+		return tx.Delete(&comment).Error
+	})
+	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
 	}
@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// defaultReactions are offered when COMMENT_REACTIONS is not set.
+var defaultReactions = []string{"👍", "❤️", "😂", "😮", "😢", "🎉"}
+
+// reactionBatchSize bounds the comment ids looked up in one reactions query.
+const reactionBatchSize = 1000
+
+// FindReactionSet godoc
+// @Summary List the reaction emojis
+// @Description List the emojis comments can be reacted to with, in display order
+// @Tags Comment
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.ReactionSetResponse
+// @Router /comments/reactions [get]
+func (controller *CommentController) FindReactionSet(ctx *gin.Context) {
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.ReactionSetResponse{
+		Emojis: controller.reactions,
+	})
+}
+
+// AddReaction godoc
+// @Summary React to a comment
+// @Description React to a comment with one of the configured emojis. Each user has one reaction per comment, so reacting with another emoji replaces it; reacting twice with the same emoji is not an error.
+// @Tags Comment
+// @Accept json
+// @Produce json
+// @Param commentId path int true "Comment ID"
+// @Param reaction body repository.ReactionRequest true "Reaction"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.CommentReactionsResponse
+// @Router /comments/{commentId}/reactions [post]
+func (controller *CommentController) AddReaction(ctx *gin.Context) {
+	principal, comment, ok := controller.findVisibleComment(ctx)
+	if !ok {
+		return
+	}
+
+	reactionRequest := repository.ReactionRequest{}
+	err := ctx.ShouldBindJSON(&reactionRequest)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	emoji, ok := controller.configuredReaction(reactionRequest.Emoji)
+	if !ok {
+		response.ValidationErrorResponse(ctx, map[string][]string{
+			"emoji": {"Emoji must be one of " + strings.Join(controller.reactions, " ")},
+		})
+		return
+	}
+
+	// the same emoji again leaves the row alone, so only an added or changed reaction affects a row
+	result := controller.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "comment_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"emoji", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "comment_reactions.emoji <> excluded.emoji"}}},
+	}).Create(&models.CommentReaction{
+		CommentId: comment.Id,
+		UserId:    principal.UserId,
+		Emoji:     emoji,
+	})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusCreated
+	}
+	controller.writeCommentReactions(ctx, status, principal.UserId, comment.Id)
+}
+
+// RemoveReaction godoc
+// @Summary Remove your reaction from a comment
+// @Description Remove your reaction, whatever its emoji. Removing a reaction you didn't add is not an error.
+// @Tags Comment
+// @Produce json
+// @Param commentId path int true "Comment ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.CommentReactionsResponse
+// @Router /comments/{commentId}/reactions [delete]
+func (controller *CommentController) RemoveReaction(ctx *gin.Context) {
+	principal, comment, ok := controller.findVisibleComment(ctx)
+	if !ok {
+		return
+	}
+
+	err := controller.db.Where("comment_id = ? AND user_id = ?", comment.Id, principal.UserId).
+		Delete(&models.CommentReaction{}).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	controller.writeCommentReactions(ctx, http.StatusOK, principal.UserId, comment.Id)
+}
+
+// findVisibleComment loads the comment in the path, writing a 404 when it doesn't exist, its photo
+// is hidden from the caller or its author blocked or was blocked by the caller.
+func (controller *CommentController) findVisibleComment(ctx *gin.Context) (auth.Principal, models.Comment, bool) {
+	var comment models.Comment
+
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return principal, comment, false
+	}
+
+	commentId, err := strconv.ParseUint(ctx.Param("commentId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid comment ID")
+		return principal, comment, false
+	}
+
+	err = controller.db.Take(&comment, commentId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "Comment not found")
+			return principal, comment, false
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return principal, comment, false
+	}
+
+	var owner models.User
+	err = controller.db.Select("users.id", "users.is_private").
+		Joins("JOIN photos ON photos.user_id = users.id").
+		Where("photos.id = ?", comment.PhotoId).
+		Take(&owner).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return principal, comment, false
+	}
+
+	visible, err := canView(controller.db, principal, owner)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return principal, comment, false
+	}
+	if !visible {
+		response.NotFoundResponse(ctx, "Comment not found")
+		return principal, comment, false
+	}
+
+	blocked, err := isBlocked(controller.db, principal.UserId, comment.UserId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return principal, comment, false
+	}
+	if blocked {
+		response.NotFoundResponse(ctx, "Comment not found")
+		return principal, comment, false
+	}
+	return principal, comment, true
+}
+
+// configuredReaction returns the configured spelling of emoji. Variation selectors are ignored
+// when comparing, so "❤" matches a configured "❤️".
+func (controller *CommentController) configuredReaction(emoji string) (string, bool) {
+	wanted := stripVariationSelector(strings.TrimSpace(emoji))
+	if wanted == "" {
+		return "", false
+	}
+	for _, reaction := range controller.reactions {
+		if stripVariationSelector(reaction) == wanted {
+			return reaction, true
+		}
+	}
+	return "", false
+}
+
+func stripVariationSelector(emoji string) string {
+	return strings.ReplaceAll(emoji, "\ufe0f", "")
+}
+
+// attachReactions fills in the reaction counts and the viewer's own reactions of comments; a viewer
+// has at most one per comment.
+func (controller *CommentController) attachReactions(viewerId uint, comments []repository.CommentCreateResponse) error {
+	commentIds := make([]uint, 0, len(comments))
+	for _, comment := range comments {
+		commentIds = append(commentIds, comment.Id)
+	}
+
+	counts, mine, err := controller.reactionsFor(viewerId, commentIds)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].Reactions = counts[comments[i].Id]
+		comments[i].MyReactions = []string{}
+		if emoji, ok := mine[comments[i].Id]; ok {
+			comments[i].MyReactions = []string{emoji}
+		}
+		if comments[i].Reactions == nil {
+			comments[i].Reactions = []repository.ReactionCount{}
+		}
+	}
+	return nil
+}
+
+// reactionsFor aggregates the reactions of the given comments, one query per reactionBatchSize
+// comments. Counts are ordered like COMMENT_REACTIONS, emojis no longer configured last.
+func (controller *CommentController) reactionsFor(viewerId uint, commentIds []uint) (map[uint][]repository.ReactionCount, map[uint]string, error) {
+	counts := map[uint][]repository.ReactionCount{}
+	mine := map[uint]string{}
+
+	for start := 0; start < len(commentIds); start += reactionBatchSize {
+		end := start + reactionBatchSize
+		if end > len(commentIds) {
+			end = len(commentIds)
+		}
+
+		var rows []struct {
+			CommentId uint
+			Emoji     string
+			Count     int64
+			Reacted   bool
+		}
+		err := controller.db.Model(&models.CommentReaction{}).
+			Select("comment_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted", viewerId).
+			Where("comment_id IN ?", commentIds[start:end]).
+			Group("comment_id, emoji").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, row := range rows {
+			counts[row.CommentId] = append(counts[row.CommentId], repository.ReactionCount{Emoji: row.Emoji, Count: row.Count})
+			if row.Reacted {
+				mine[row.CommentId] = row.Emoji
+			}
+		}
+	}
+
+	rank := make(map[string]int, len(controller.reactions))
+	for i, reaction := range controller.reactions {
+		rank[reaction] = i
+	}
+	less := func(a, b string) bool {
+		rankA, okA := rank[a]
+		rankB, okB := rank[b]
+		if okA != okB {
+			return okA
+		}
+		if okA {
+			return rankA < rankB
+		}
+		return a < b
+	}
+	for _, list := range counts {
+		sort.Slice(list, func(i, j int) bool { return less(list[i].Emoji, list[j].Emoji) })
+	}
+
+	return counts, mine, nil
+}
+
+func (controller *CommentController) writeCommentReactions(ctx *gin.Context, status int, viewerId, commentId uint) {
+	comments := []repository.CommentCreateResponse{{Id: commentId}}
+	err := controller.attachReactions(viewerId, comments)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, status, repository.CommentReactionsResponse{
+		CommentId:   commentId,
+		Reactions:   comments[0].Reactions,
+		MyReactions: comments[0].MyReactions,
+	})
+}
@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+)
+
+type FeedController struct {
+	db        *gorm.DB
+	timelines *repository.TimelineStore
+}
+
+func NewFeedController(db *gorm.DB, timelines *repository.TimelineStore) *FeedController {
+	return &FeedController{
+		db:        db,
+		timelines: timelines,
+	}
+}
+
+// feedRow is one scanned feed row; the author columns are flattened by the query.
+type feedRow struct {
+	Id                uint
+	Title             string
+	Caption           string
+	PhotoUrl          string
+	UserId            uint
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	AuthorUsername    string
+	AuthorDisplayName string
+	AuthorAvatarUrl   string
+	LikeCount         int64
+	CommentCount      int64
+	Liked             bool
+}
+
+// The page of photos is picked first and only then joined with authors and counted, so the
+// comment count runs once per returned photo instead of once per candidate.
+const feedQuery = `
+WITH page AS (%s)
+SELECT page.*,
+	users.username AS author_username,
+	users.display_name AS author_display_name,
+	users.avatar_url AS author_avatar_url,
+	(SELECT COUNT(*) FROM comments WHERE comments.photo_id = page.id) AS comment_count,
+	EXISTS (SELECT 1 FROM likes WHERE likes.photo_id = page.id AND likes.user_id = @viewer) AS liked
+FROM page
+JOIN users ON users.id = page.user_id
+ORDER BY page.created_at DESC, page.id DESC`
+
+// pullPage reads the viewer's and the followed accounts' photos directly.
+const pullPage = `
+	SELECT photos.id, photos.title, photos.caption, photos.photo_url, photos.user_id, photos.like_count, photos.created_at, photos.updated_at
+	FROM photos
+	WHERE (photos.user_id = @viewer OR photos.user_id IN (SELECT following_id FROM follows WHERE follower_id = @viewer))
+		AND photos.user_id NOT IN (SELECT muted_id FROM mutes WHERE muter_id = @viewer)
+	%[1]s
+	ORDER BY photos.created_at DESC, photos.id DESC
+	LIMIT @limit`
+
+// timelinePage merges the materialized timeline with the viewer's own photos and the followed
+// accounts' photos that were not fanned out. Each branch is paged on its own index before the merge.
+// Muted authors are filtered per branch so a page is never cut short; their entries are kept for
+// when they are unmuted.
+const timelinePage = `
+	SELECT photos.id, photos.title, photos.caption, photos.photo_url, photos.user_id, photos.like_count, photos.created_at, photos.updated_at
+	FROM photos
+	JOIN (
+		(SELECT photo_id AS id FROM timeline_entries
+			WHERE user_id = @viewer
+				AND author_id NOT IN (SELECT muted_id FROM mutes WHERE muter_id = @viewer) %[2]s
+			ORDER BY photo_created_at DESC, photo_id DESC LIMIT @limit)
+		UNION
+		(SELECT id FROM photos
+			WHERE user_id = @viewer %[1]s
+			ORDER BY created_at DESC, id DESC LIMIT @limit)
+		UNION
+		(SELECT id FROM photos
+			WHERE NOT fanned_out AND user_id IN (SELECT following_id FROM follows WHERE follower_id = @viewer)
+				AND user_id NOT IN (SELECT muted_id FROM mutes WHERE muter_id = @viewer) %[1]s
+			ORDER BY created_at DESC, id DESC LIMIT @limit)
+	) candidates ON candidates.id = photos.id
+	ORDER BY photos.created_at DESC, photos.id DESC
+	LIMIT @limit`
+
+// FindFeed godoc
+// @Summary Home feed
+// @Description Photos from the accounts the authenticated user follows and their own, newest first
+// @Tags Photos
+// @Produce json
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param limit query int false "Page size, at most 100"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.FeedResponse
+// @Router /feed [get]
+func (controller *FeedController) FindFeed(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	limit, ok := limitParam(ctx)
+	if !ok {
+		return
+	}
+
+	args := map[string]interface{}{
+		"viewer": principal.UserId,
+		// one extra row tells whether there is a next page
+		"limit": limit + 1,
+	}
+	photoCursor, timelineCursor := "", ""
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		before, beforeId, err := decodeCursor(cursor)
+		if err != nil {
+			response.BadRequestResponse(ctx, err.Error())
+			return
+		}
+		photoCursor = "AND (photos.created_at, photos.id) < (@before, @beforeId)"
+		timelineCursor = "AND (photo_created_at, photo_id) < (@before, @beforeId)"
+		args["before"] = before
+		args["beforeId"] = beforeId
+	}
+
+	page := pullPage
+	if controller.timelines.Enabled() {
+		page = timelinePage
+	}
+
+	var rows []feedRow
+	err = controller.db.Raw(fmt.Sprintf(feedQuery, fmt.Sprintf(page, photoCursor, timelineCursor)), args).Scan(&rows).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	feed := repository.FeedResponse{
+		Items: make([]repository.FeedItem, 0, len(rows)),
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		feed.NextCursor = encodeCursor(last.CreatedAt, last.Id)
+	}
+
+	for i := range rows {
+		row := rows[i]
+		feed.Items = append(feed.Items, repository.FeedItem{
+			Id:       row.Id,
+			Title:    row.Title,
+			Caption:  row.Caption,
+			PhotoUrl: row.PhotoUrl,
+			User: repository.UserPhotoResponse{
+				Id:          row.UserId,
+				Username:    row.AuthorUsername,
+				DisplayName: row.AuthorDisplayName,
+				AvatarUrl:   row.AuthorAvatarUrl,
+			},
+			LikeCount:    row.LikeCount,
+			CommentCount: row.CommentCount,
+			Liked:        row.Liked,
+			CreatedAt:    &rows[i].CreatedAt,
+			UpdatedAt:    &rows[i].UpdatedAt,
+		})
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, feed)
+}
@@ -0,0 +1,473 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FollowController struct {
+	db        *gorm.DB
+	timelines *repository.TimelineStore
+}
+
+func NewFollowController(db *gorm.DB, timelines *repository.TimelineStore) *FollowController {
+	return &FollowController{
+		db:        db,
+		timelines: timelines,
+	}
+}
+
+// FollowUser godoc
+// @Summary Follow a user
+// @Description Follow the user with the given username. Following a private account sends a follow request instead,
+// @Description answered with 202 until the owner approves it. Following someone twice is not an error.
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.FollowResponse
+// @Success 202 {object} repository.FollowResponse
+// @Router /users/{username}/follow [post]
+func (controller *FollowController) FollowUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	if target.Id == principal.UserId {
+		response.BadRequestResponse(ctx, "You can't follow yourself")
+		return
+	}
+
+	blocked, err := isBlocked(controller.db, principal.UserId, target.Id)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if blocked {
+		response.WriteJsonResponse(ctx, http.StatusForbidden, gin.H{
+			"error":   true,
+			"code":    "blocked",
+			"message": "You can't follow this user",
+		})
+		return
+	}
+
+	if target.IsPrivate {
+		controller.requestFollow(ctx, principal.UserId, target)
+		return
+	}
+
+	result := controller.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Follow{
+		FollowerId:  principal.UserId,
+		FollowingId: target.Id,
+	})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusCreated
+		controller.timelines.Followed(principal.UserId, target.Id)
+	}
+	controller.writeFollowState(ctx, status, principal.UserId, target)
+}
+
+// UnfollowUser godoc
+// @Summary Unfollow a user
+// @Description Stop following the user with the given username, or cancel a pending follow request
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.FollowResponse
+// @Router /users/{username}/follow [delete]
+func (controller *FollowController) UnfollowUser(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	target, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	result := controller.db.Where("follower_id = ? AND following_id = ?", principal.UserId, target.Id).Delete(&models.Follow{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected > 0 {
+		err = controller.timelines.Unfollowed(principal.UserId, target.Id)
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+		controller.writeFollowState(ctx, http.StatusOK, principal.UserId, target)
+		return
+	}
+
+	// not following yet, so cancel a pending request instead
+	result = controller.db.Where("requester_id = ? AND target_id = ?", principal.UserId, target.Id).Delete(&models.FollowRequest{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "You are not following this user")
+		return
+	}
+
+	controller.writeFollowState(ctx, http.StatusOK, principal.UserId, target)
+}
+
+// FindAllFollower godoc
+// @Summary List followers
+// @Description List the users following the given user, newest first
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Param page query int false "Page, starting at 1"
+// @Param limit query int false "Page size, at most 100"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.FollowListResponse
+// @Router /users/{username}/followers [get]
+func (controller *FollowController) FindAllFollower(ctx *gin.Context) {
+	controller.writeFollowList(ctx, "follower_id", "following_id")
+}
+
+// FindAllFollowing godoc
+// @Summary List followed users
+// @Description List the users the given user follows, newest first
+// @Tags follows
+// @Produce json
+// @Param username path string true "Username"
+// @Param page query int false "Page, starting at 1"
+// @Param limit query int false "Page size, at most 100"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.FollowListResponse
+// @Router /users/{username}/following [get]
+func (controller *FollowController) FindAllFollowing(ctx *gin.Context) {
+	controller.writeFollowList(ctx, "following_id", "follower_id")
+}
+
+// FindAllFollowRequest godoc
+// @Summary List follow requests
+// @Description List the pending requests to follow the authenticated user, newest first
+// @Tags follows
+// @Produce json
+// @Param page query int false "Page, starting at 1"
+// @Param limit query int false "Page size, at most 100"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.FollowRequestListResponse
+// @Router /users/follow-requests [get]
+func (controller *FollowController) FindAllFollowRequest(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	page, limit, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+
+	var total int64
+	err = controller.db.Model(&models.FollowRequest{}).Where("target_id = ?", principal.UserId).Count(&total).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	requests := []repository.FollowRequestData{}
+	err = controller.db.Table("follow_requests").
+		Select("follow_requests.id, users.username, users.display_name, users.avatar_url, follow_requests.created_at AS requested_at").
+		Joins("JOIN users ON users.id = follow_requests.requester_id").
+		Where("follow_requests.target_id = ?", principal.UserId).
+		Order("follow_requests.created_at DESC, follow_requests.id DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Scan(&requests).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.FollowRequestListResponse{
+		Requests: requests,
+		Page:     page,
+		Limit:    limit,
+		Total:    total,
+	})
+}
+
+// ApproveFollowRequest godoc
+// @Summary Approve a follow request
+// @Description Let the requester follow the authenticated user
+// @Tags follows
+// @Produce json
+// @Param requestId path int true "Follow request ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/follow-requests/{requestId}/approve [post]
+func (controller *FollowController) ApproveFollowRequest(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	requestId, err := strconv.ParseUint(ctx.Param("requestId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid follow request ID")
+		return
+	}
+
+	followerIds, err := approveFollowRequests(controller.db, principal.UserId, uint(requestId))
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if len(followerIds) == 0 {
+		response.NotFoundResponse(ctx, "Follow request not found")
+		return
+	}
+	controller.timelines.Followed(followerIds[0], principal.UserId)
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "Follow request approved",
+	})
+}
+
+// RejectFollowRequest godoc
+// @Summary Reject a follow request
+// @Description Delete a pending request to follow the authenticated user. The requester is not notified.
+// @Tags follows
+// @Produce json
+// @Param requestId path int true "Follow request ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/follow-requests/{requestId} [delete]
+func (controller *FollowController) RejectFollowRequest(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	requestId, err := strconv.ParseUint(ctx.Param("requestId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid follow request ID")
+		return
+	}
+
+	result := controller.db.Where("id = ? AND target_id = ?", requestId, principal.UserId).Delete(&models.FollowRequest{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "Follow request not found")
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "Follow request rejected",
+	})
+}
+
+// requestFollow asks a private account for approval; someone who already follows it stays a follower.
+func (controller *FollowController) requestFollow(ctx *gin.Context, requesterId uint, target models.User) {
+	var following int64
+	err := controller.db.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", requesterId, target.Id).
+		Count(&following).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if following > 0 {
+		controller.writeFollowState(ctx, http.StatusOK, requesterId, target)
+		return
+	}
+
+	result := controller.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.FollowRequest{
+		RequesterId: requesterId,
+		TargetId:    target.Id,
+	})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusAccepted
+	}
+	controller.writeFollowState(ctx, status, requesterId, target)
+}
+
+// writeFollowList lists the users on the listed side of the follows whose owner side is the requested user.
+// A listed user is mutual when they and the requested user follow each other.
+func (controller *FollowController) writeFollowList(ctx *gin.Context, listed, owner string) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	page, limit, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+
+	user, ok := findUser(ctx, controller.db, ctx.Param("username"))
+	if !ok {
+		return
+	}
+
+	visible, err := canView(controller.db, principal, user)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if !visible {
+		writeHidden(ctx, user)
+		return
+	}
+
+	var total int64
+	err = controller.db.Model(&models.Follow{}).Where(owner+" = ?", user.Id).Count(&total).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	users := []repository.FollowUserData{}
+	err = controller.db.Table("follows").
+		Select("users.id, users.username, users.display_name, users.avatar_url, follows.created_at AS followed_at, "+
+			"EXISTS (SELECT 1 FROM follows AS back WHERE back."+owner+" = follows."+listed+" AND back."+listed+" = follows."+owner+") AS mutual").
+		Joins("JOIN users ON users.id = follows."+listed).
+		Where("follows."+owner+" = ?", user.Id).
+		Order("follows.created_at DESC, follows.id DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Scan(&users).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.FollowListResponse{
+		Users: users,
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	})
+}
+
+func (controller *FollowController) writeFollowState(ctx *gin.Context, status int, viewerId uint, target models.User) {
+	var following, followedBy int64
+	err := controller.db.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", viewerId, target.Id).
+		Count(&following).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	err = controller.db.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", target.Id, viewerId).
+		Count(&followedBy).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	var requested int64
+	err = controller.db.Model(&models.FollowRequest{}).
+		Where("requester_id = ? AND target_id = ?", viewerId, target.Id).
+		Count(&requested).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, status, repository.FollowResponse{
+		Username:   target.Username,
+		Following:  following > 0,
+		FollowedBy: followedBy > 0,
+		Mutual:     following > 0 && followedBy > 0,
+		Requested:  requested > 0,
+	})
+}
+
+// findUser loads the id, username and privacy of the user with username, writing a 404 when there is none.
+func findUser(ctx *gin.Context, db *gorm.DB, username string) (models.User, bool) {
+	var user models.User
+	err := db.Select("id", "username", "is_private").Where("username = ?", username).Take(&user).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return user, false
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return user, false
+	}
+	return user, true
+}
+
+// approveFollowRequests turns pending requests to targetId into follows, only the given ones
+// when requestIds is not empty, and returns the ids of the users who now follow targetId.
+func approveFollowRequests(db *gorm.DB, targetId uint, requestIds ...uint) ([]uint, error) {
+	var requests []models.FollowRequest
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Returning{}).Where("target_id = ?", targetId)
+		if len(requestIds) > 0 {
+			query = query.Where("id IN ?", requestIds)
+		}
+		if err := query.Delete(&requests).Error; err != nil {
+			return err
+		}
+		if len(requests) == 0 {
+			return nil
+		}
+
+		follows := make([]models.Follow, 0, len(requests))
+		for _, request := range requests {
+			follows = append(follows, models.Follow{
+				FollowerId:  request.RequesterId,
+				FollowingId: targetId,
+			})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&follows, 500).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	followerIds := make([]uint, 0, len(requests))
+	for _, request := range requests {
+		followerIds = append(followerIds, request.RequesterId)
+	}
+	return followerIds, nil
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+)
+
+type KeyController struct {
+	keyring *auth.Keyring
+}
+
+func NewKeyController(keyring *auth.Keyring) *KeyController {
+	return &KeyController{
+		keyring: keyring,
+	}
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys that verify access tokens issued by MyGRAM
+// @Tags keys
+// @Produce json
+// @Success 200 {object} auth.JSONWebKeySet
+// @Router /.well-known/jwks.json [get]
+func (controller *KeyController) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	response.WriteJsonResponse(ctx, http.StatusOK, controller.keyring.JWKS())
+}
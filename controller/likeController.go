@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type LikeController struct {
+	db *gorm.DB
+}
+
+func NewLikeController(db *gorm.DB) *LikeController {
+	return &LikeController{
+		db: db,
+	}
+}
+
+// LikePhoto godoc
+// @Summary Like a photo
+// @Description Like the photo with the given ID. Liking a photo twice is not an error.
+// @Tags Photos
+// @Produce json
+// @Param photoId path int true "Photo ID"
+// @Security ApiKeyAuth
+// @Success 201 {object} repository.LikeResponse
+// @Router /photos/{photoId}/like [post]
+func (controller *LikeController) LikePhoto(ctx *gin.Context) {
+	principal, photo, ok := controller.findPhoto(ctx)
+	if !ok {
+		return
+	}
+
+	var liked int64
+	err := controller.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Like{
+			UserId:  principal.UserId,
+			PhotoId: photo.Id,
+		})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		liked = result.RowsAffected
+
+		// the increment happens in SQL so concurrent likes can't overwrite each other
+		return tx.Model(&models.Photo{}).Where("id = ?", photo.Id).UpdateColumn("like_count", gorm.Expr("like_count + 1")).Error
+	})
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if liked > 0 {
+		status = http.StatusCreated
+	}
+	controller.writeLikeState(ctx, status, principal.UserId, photo.Id)
+}
+
+// UnlikePhoto godoc
+// @Summary Unlike a photo
+// @Description Remove your like from the photo with the given ID. Unliking a photo you don't like is not an error.
+// @Tags Photos
+// @Produce json
+// @Param photoId path int true "Photo ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.LikeResponse
+// @Router /photos/{photoId}/like [delete]
+func (controller *LikeController) UnlikePhoto(ctx *gin.Context) {
+	principal, photo, ok := controller.findPhoto(ctx)
+	if !ok {
+		return
+	}
+
+	err := controller.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("user_id = ? AND photo_id = ?", principal.UserId, photo.Id).Delete(&models.Like{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Photo{}).Where("id = ?", photo.Id).UpdateColumn("like_count", gorm.Expr("like_count - 1")).Error
+	})
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	controller.writeLikeState(ctx, http.StatusOK, principal.UserId, photo.Id)
+}
+
+// FindAllLike godoc
+// @Summary List the users who liked a photo
+// @Description List the users who liked the photo with the given ID, newest like first
+// @Tags Photos
+// @Produce json
+// @Param photoId path int true "Photo ID"
+// @Param page query int false "Page, starting at 1"
+// @Param limit query int false "Page size, at most 100"
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.LikeListResponse
+// @Router /photos/{photoId}/likes [get]
+func (controller *LikeController) FindAllLike(ctx *gin.Context) {
+	page, limit, ok := pageParams(ctx)
+	if !ok {
+		return
+	}
+
+	principal, photo, ok := controller.findPhoto(ctx)
+	if !ok {
+		return
+	}
+
+	query := controller.db.Table("likes").
+		Joins("JOIN users ON users.id = likes.user_id").
+		Where("likes.photo_id = ?", photo.Id).
+		Where(notBlocked("users.id"), sql.Named("viewer", principal.UserId)).
+		Session(&gorm.Session{})
+
+	var total int64
+	err := query.Count(&total).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	users := []repository.LikeUserData{}
+	err = query.
+		Select("users.id, users.username, users.display_name, users.avatar_url, likes.created_at AS liked_at").
+		Order("likes.created_at DESC, likes.id DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Scan(&users).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.LikeListResponse{
+		Users: users,
+		Page:  page,
+		Limit: limit,
+		Total: total,
+	})
+}
+
+func (controller *LikeController) findPhoto(ctx *gin.Context) (auth.Principal, models.Photo, bool) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return principal, models.Photo{}, false
+	}
+
+	photoId, err := strconv.ParseUint(ctx.Param("photoId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid photo ID")
+		return principal, models.Photo{}, false
+	}
+
+	photo, ok := findVisiblePhoto(ctx, controller.db, principal, uint(photoId))
+	return principal, photo, ok
+}
+
+func (controller *LikeController) writeLikeState(ctx *gin.Context, status int, userId, photoId uint) {
+	var photo models.Photo
+	err := controller.db.Select("id", "like_count").Take(&photo, photoId).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	var liked int64
+	err = controller.db.Model(&models.Like{}).Where("user_id = ? AND photo_id = ?", userId, photoId).Count(&liked).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, status, repository.LikeResponse{
+		PhotoId:   photo.Id,
+		Liked:     liked > 0,
+		LikeCount: photo.LikeCount,
+	})
+}
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// pageParams reads ?page= (1-based) and ?limit= and writes a 400 when either is not a positive number.
+func pageParams(ctx *gin.Context) (page int, limit int, ok bool) {
+	page = 1
+
+	if value := ctx.Query("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			response.BadRequestResponse(ctx, "page must be a positive number")
+			return 0, 0, false
+		}
+		page = parsed
+	}
+
+	limit, ok = limitParam(ctx)
+	return page, limit, ok
+}
+
+var errInvalidCursor = errors.New("cursor is invalid")
+
+// encodeCursor makes an opaque cursor pointing just after the row with createdAt and id.
+func encodeCursor(createdAt time.Time, id uint) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(id), 10)))
+}
+
+func decodeCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	parsedTime, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	parsedId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+	return parsedTime, uint(parsedId), nil
+}
+
+// limitParam reads ?limit= for cursor paginated lists and writes a 400 when it is not a positive number.
+func limitParam(ctx *gin.Context) (int, bool) {
+	value := ctx.Query("limit")
+	if value == "" {
+		return defaultPageLimit, true
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		response.BadRequestResponse(ctx, "limit must be a positive number")
+		return 0, false
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, true
+}
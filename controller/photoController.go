@@ -5,6 +5,8 @@ import (
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
@@ -12,12 +14,14 @@ import (
 )
 
 type PhotoController struct {
-	db *gorm.DB
+	db        *gorm.DB
+	timelines *repository.TimelineStore
 }
 
-func NewPhotoController(db *gorm.DB) *PhotoController {
+func NewPhotoController(db *gorm.DB, timelines *repository.TimelineStore) *PhotoController {
 	return &PhotoController{
-		db: db,
+		db:        db,
+		timelines: timelines,
 	}
 }
 
@@ -33,10 +37,15 @@ func NewPhotoController(db *gorm.DB) *PhotoController {
 // @Router /photos [post]
 
 func (controller *PhotoController) CreatePhoto(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	photoRequest := repository.PhotoRequest{}
 
-	err := ctx.ShouldBindJSON(&photoRequest)
+	err = ctx.ShouldBindJSON(&photoRequest)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
@@ -46,7 +55,7 @@ func (controller *PhotoController) CreatePhoto(ctx *gin.Context) {
 		Title:    photoRequest.Title,
 		Caption:  photoRequest.Caption,
 		PhotoUrl: photoRequest.PhotoUrl,
-		UserId:   uint(userId.(float64)),
+		UserId:   principal.UserId,
 	}
 
 	_, err = govalidator.ValidateStruct(&photo)
@@ -64,6 +73,7 @@ func (controller *PhotoController) CreatePhoto(ctx *gin.Context) {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
 	}
+	controller.timelines.Publish(photo.Id)
 
 	response.WriteJsonResponse(ctx, http.StatusCreated, repository.PhotoCreateResponse{
 		Id:        photo.Id,
@@ -71,6 +81,7 @@ func (controller *PhotoController) CreatePhoto(ctx *gin.Context) {
 		Caption:   photo.Caption,
 		PhotoUrl:  photo.PhotoUrl,
 		UserId:    photo.UserId,
+		LikeCount: photo.LikeCount,
 		CreatedAt: photo.CreatedAt,
 	})
 }
@@ -85,10 +96,15 @@ func (controller *PhotoController) CreatePhoto(ctx *gin.Context) {
 // @Success 200 {array} models.Photo
 // @Router /photo [get]
 func (controller *PhotoController) FindAllPhoto(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	var photos []models.Photo
 
-	err := controller.db.Where("user_id = ?", userId).Find(&photos).Error
+	err = controller.db.Where("user_id = ?", principal.UserId).Find(&photos).Error
 	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
@@ -109,11 +125,16 @@ func (controller *PhotoController) FindAllPhoto(ctx *gin.Context) {
 // @Success 200 {object} repository.PhotoCreateResponse
 // @Router /photo/{photoId} [put]
 func (controller *PhotoController) UpdatePhoto(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	photoId := ctx.Param("photoId")
 
 	var photo models.Photo
-	err := controller.db.First(&photo, photoId).Error
+	err = controller.db.First(&photo, photoId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -123,7 +144,7 @@ func (controller *PhotoController) UpdatePhoto(ctx *gin.Context) {
 		return
 	}
 
-	if photo.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionUpdate, auth.ResourcePhoto, photo.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to update this photo",
@@ -148,7 +169,8 @@ func (controller *PhotoController) UpdatePhoto(ctx *gin.Context) {
 		return
 	}
 
-	err = controller.db.Save(&photo).Error
+	// only the edited columns are written so concurrent likes and fan-out are not overwritten
+	err = controller.db.Model(&photo).Select("title", "caption", "photo_url").Updates(&photo).Error
 	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
@@ -160,13 +182,14 @@ func (controller *PhotoController) UpdatePhoto(ctx *gin.Context) {
 		Caption:   photo.Caption,
 		PhotoUrl:  photo.PhotoUrl,
 		UserId:    photo.UserId,
+		LikeCount: photo.LikeCount,
 		CreatedAt: photo.CreatedAt,
 	})
 }
 
 // DeletePhoto godoc
 // @Summary Delete photo data of the authenticated user
-// @Description Delete photo data of the authenticated user
+// @Description Delete photo data of the authenticated user, together with its comments, their reactions and its likes
 // @Tags Photos
 // @Accept json
 // @Produce json
@@ -175,11 +198,16 @@ func (controller *PhotoController) UpdatePhoto(ctx *gin.Context) {
 // @Success 200 {object} gin.H
 // @Router /photos/{photoId} [delete]
 func (controller *PhotoController) DeletePhoto(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	photoId := ctx.Param("photoId")
 	var photo models.Photo
 
-	err := controller.db.First(&photo, photoId).Error
+	err = controller.db.First(&photo, photoId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -189,7 +217,7 @@ func (controller *PhotoController) DeletePhoto(ctx *gin.Context) {
 		return
 	}
 
-	if photo.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionDelete, auth.ResourcePhoto, photo.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to delete this photo",
@@ -197,12 +225,25 @@ func (controller *PhotoController) DeletePhoto(ctx *gin.Context) {
 		return
 	}
 
-	err = controller.db.Delete(&photo).Error
-	if err != nil {
-		if err.Error() == gorm.ErrRecordNotFound.Error() {
-			response.NotFoundResponse(ctx, err.Error())
-			return
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		if err := controller.timelines.RemovePhoto(tx, photo.Id); err != nil {
+			return err
+		}
+		if err := tx.Where("photo_id = ?", photo.Id).Delete(&models.Like{}).Error; err != nil {
+			return err
+		}
+		// the comments go with the photo instead of being detached, and their reactions with them
+		err := tx.Where("comment_id IN (?)", tx.Model(&models.Comment{}).Select("id").Where("photo_id = ?", photo.Id)).
+			Delete(&models.CommentReaction{}).Error
+		if err != nil {
+			return err
 		}
+		if err := tx.Where("photo_id = ?", photo.Id).Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&photo).Error
+	})
+	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
 	}
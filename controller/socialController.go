@@ -5,6 +5,8 @@ import (
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
@@ -30,10 +32,15 @@ func NewSocialController(db *gorm.DB) *SocialController {
 // @Success 200 {array} repository.SocialCreateResponse
 // @Router /social [post]
 func (controller *SocialController) CreateSocial(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	socialRequest := repository.SocialRequest{}
 
-	err := ctx.ShouldBindJSON(&socialRequest)
+	err = ctx.ShouldBindJSON(&socialRequest)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
@@ -42,7 +49,7 @@ func (controller *SocialController) CreateSocial(ctx *gin.Context) {
 	social := models.Social{
 		Name:           socialRequest.Name,
 		SocialMediaUrl: socialRequest.SocialMediaUrl,
-		UserId:         uint(userId.(float64)),
+		UserId:         principal.UserId,
 	}
 
 	_, err = govalidator.ValidateStruct(&social)
@@ -79,10 +86,15 @@ func (controller *SocialController) CreateSocial(ctx *gin.Context) {
 // @Success 200 {array} repository.SocialCreateResponse
 // @Router /social [get]
 func (controller *SocialController) FindAllSocial(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	var socials []models.Social
 
-	err := controller.db.Where("user_id = ?", userId).Find(&socials).Error
+	err = controller.db.Where("user_id = ?", principal.UserId).Find(&socials).Error
 	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
@@ -114,11 +126,16 @@ func (controller *SocialController) FindAllSocial(ctx *gin.Context) {
 // @Success 200 {object} repository.SocialCreateResponse
 // @Router /social/{socialMediaId} [put]
 func (controller *SocialController) UpdateSocial(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	socialMediaId := ctx.Param("socialMediaId")
 	var social models.Social
 
-	err := controller.db.First(&social, socialMediaId).Error
+	err = controller.db.First(&social, socialMediaId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -128,7 +145,7 @@ func (controller *SocialController) UpdateSocial(ctx *gin.Context) {
 		return
 	}
 
-	if social.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionUpdate, auth.ResourceSocial, social.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to update this social media",
@@ -179,11 +196,16 @@ func (controller *SocialController) UpdateSocial(ctx *gin.Context) {
 // @Success 200 {object} gin.H
 // @Router /social/{socialMediaId} [delete]
 func (controller *SocialController) DeleteSocial(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	socialMediaId := ctx.Param("socialMediaId")
 	var social models.Social
 
-	err := controller.db.First(&social, socialMediaId).Error
+	err = controller.db.First(&social, socialMediaId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "data not found")
@@ -193,7 +215,7 @@ func (controller *SocialController) DeleteSocial(ctx *gin.Context) {
 		return
 	}
 
-	if social.UserId != uint(userId.(float64)) {
+	if !principal.Can(auth.ActionDelete, auth.ResourceSocial, social.UserId) {
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "you're not allowed to delete this social media",
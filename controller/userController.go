@@ -1,24 +1,60 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/gin-gonic/gin"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/limiter"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/mailer"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/oidc"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserController struct {
-	db *gorm.DB
+	db               *gorm.DB
+	refreshTokens    *repository.RefreshTokenStore
+	revocations      *repository.RevocationStore
+	sessions         *repository.SessionStore
+	apiKeys          *repository.ApiKeyStore
+	userTokens       *repository.UserTokenStore
+	mailer           mailer.Mailer
+	loginLimiter     *limiter.LoginLimiter
+	magicLinkLimiter *limiter.LoginLimiter
+	oidc             *oidc.Provider
+	relyingParty     auth.RelyingParty
+	passwords        auth.PasswordPolicy
+	timelines        *repository.TimelineStore
 }
 
-func NewUserController(db *gorm.DB) *UserController {
+func NewUserController(db *gorm.DB, revocations *repository.RevocationStore, sessions *repository.SessionStore, apiKeys *repository.ApiKeyStore, mail mailer.Mailer, loginLimiter, magicLinkLimiter *limiter.LoginLimiter, oidcProvider *oidc.Provider, timelines *repository.TimelineStore) *UserController {
 	return &UserController{
-		db: db,
+		db:               db,
+		refreshTokens:    repository.NewRefreshTokenStore(db),
+		revocations:      revocations,
+		sessions:         sessions,
+		apiKeys:          apiKeys,
+		userTokens:       repository.NewUserTokenStore(db),
+		mailer:           mail,
+		loginLimiter:     loginLimiter,
+		magicLinkLimiter: magicLinkLimiter,
+		oidc:             oidcProvider,
+		relyingParty:     auth.RelyingPartyFromEnv(),
+		passwords:        auth.PasswordPolicyFromEnv(),
+		timelines:        timelines,
 	}
 }
 
@@ -27,24 +63,38 @@ func NewUserController(db *gorm.DB) *UserController {
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body User true "User object to create"
+// @Param user body repository.UserRegisterRequest true "User object to create"
 // @Success 201 {object} UserCreateResponse
 // @Router /users [post]
 func (controller *UserController) CreateUser(ctx *gin.Context) {
-	user := models.User{}
+	registerReq := repository.UserRegisterRequest{}
 
-	err := ctx.ShouldBindJSON(&user)
+	err := ctx.ShouldBindJSON(&registerReq)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
 	}
 
-	_, err = govalidator.ValidateStruct(&user)
+	_, err = govalidator.ValidateStruct(&registerReq)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
 	}
 
+	if !controller.checkPassword(ctx, "password", registerReq.Password, registerReq.Username, registerReq.Email) {
+		return
+	}
+
+	// role, verification, two-factor and profile state can't be set at registration; the
+	// profile is validated and set through PUT /users/profile
+	user := models.User{
+		Username: registerReq.Username,
+		Email:    registerReq.Email,
+		Password: registerReq.Password,
+		Age:      registerReq.Age,
+		Role:     auth.RoleUser,
+	}
+
 	err = controller.db.Create(&user).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
@@ -55,6 +105,10 @@ func (controller *UserController) CreateUser(ctx *gin.Context) {
 		return
 	}
 
+	if err := controller.sendEmailVerification(user); err != nil {
+		log.Println("email verification:", err)
+	}
+
 	response.WriteJsonResponse(ctx, http.StatusCreated, repository.UserCreateResponse{
 		Id:       user.Id,
 		Username: user.Username,
@@ -80,9 +134,24 @@ func (controller *UserController) UserLogin(ctx *gin.Context) {
 	}
 
 	password := user.Password
-	err = controller.db.Debug().Where("email = ?", user.Email).Take(&user).Error
+	email := user.Email
+	account := strings.ToLower(email)
+
+	retryAfter, err := controller.loginLimiter.Check(account, ctx.ClientIP())
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if retryAfter > 0 {
+		controller.recordLoginFailure(ctx, email, nil, "throttled")
+		response.TooManyRequestsResponse(ctx, retryAfter, "too many failed login attempts, try again later")
+		return
+	}
+
+	err = controller.db.Debug().Where("email = ?", email).Take(&user).Error
 
 	if err != nil {
+		controller.failLogin(ctx, account, email, nil, "unknown_email")
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "username / password is not match",
@@ -92,15 +161,655 @@ func (controller *UserController) UserLogin(ctx *gin.Context) {
 
 	comparePass := auth.ComparePassword(user.Password, password)
 	if !comparePass {
+		controller.failLogin(ctx, account, email, &user.Id, "wrong_password")
 		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
 			"error":   true,
 			"message": "username / password is not match",
 		})
 		return
 	}
-	token := auth.GenerateToken(user.Id, user.Email)
+
+	err = controller.loginLimiter.Succeed(account)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// the plain password is only known here, so this is where old hashes get upgraded
+	if auth.PasswordNeedsRehash(user.Password) {
+		controller.rehashPassword(user, password)
+	}
+
+	if user.TotpEnabledAt != nil {
+		controller.writeMfaChallenge(ctx, user)
+		return
+	}
+
+	controller.startSession(ctx, user)
+}
+
+// failLogin counts a failed attempt against the account and client IP and audits it.
+func (controller *UserController) failLogin(ctx *gin.Context, account, email string, userId *uint, reason string) {
+	if _, err := controller.loginLimiter.Fail(account, ctx.ClientIP()); err != nil {
+		log.Println("login limiter:", err)
+	}
+	controller.recordLoginFailure(ctx, email, userId, reason)
+}
+
+func (controller *UserController) recordLoginFailure(ctx *gin.Context, email string, userId *uint, reason string) {
+	err := controller.db.Create(&models.LoginAttempt{
+		Email:     email,
+		UserId:    userId,
+		Ip:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+		Reason:    reason,
+	}).Error
+	if err != nil {
+		log.Println("login audit:", err)
+	}
+}
+
+// RefreshToken godoc
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a rotated refresh token
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserRefreshRequest true "Refresh token"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /users/refresh [post]
+func (controller *UserController) RefreshToken(ctx *gin.Context) {
+	refreshReq := repository.UserRefreshRequest{}
+	err := ctx.ShouldBindJSON(&refreshReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	refreshToken, previous, err := controller.refreshTokens.Rotate(refreshReq.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "refresh_token_reused",
+				"message": err.Error(),
+			})
+		case errors.Is(err, repository.ErrRefreshTokenExpired):
+			response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "refresh_token_expired",
+				"message": err.Error(),
+			})
+		case errors.Is(err, repository.ErrRefreshTokenInvalid):
+			response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
+				"error":   true,
+				"code":    "refresh_token_invalid",
+				"message": err.Error(),
+			})
+		default:
+			response.InternalServerJsonResponse(ctx, err.Error())
+		}
+		return
+	}
+
+	var user models.User
+	err = controller.db.First(&user, previous.UserId).Error
+	if err != nil {
+		response.UnauthorizedResponse(ctx, "User not found")
+		return
+	}
+
+	if err := controller.sessions.Touch(previous.FamilyId, ctx.ClientIP()); err != nil {
+		log.Println("session last seen:", err)
+	}
+
+	controller.writeTokenPair(ctx, user, refreshToken, previous.FamilyId)
+}
+
+// Logout godoc
+// @Summary Log out the current session
+// @Description Revoke the access token used for this request and its refresh token family
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/logout [post]
+func (controller *UserController) Logout(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.revocations.RevokeToken(principal.TokenId, principal.UserId, principal.ExpiresAt)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if principal.SessionId != "" {
+		err = controller.endSession(principal.SessionId)
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "You have been logged out",
+	})
+}
+
+// LogoutAll godoc
+// @Summary Log out every session
+// @Description Revoke every access and refresh token issued to the authenticated user
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/logout-all [post]
+func (controller *UserController) LogoutAll(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.revokeAllTokens(principal.UserId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "All of your sessions have been logged out",
+	})
+}
+
+// AssignRole godoc
+// @Summary Assign a role to a user
+// @Description Change the role of a user (user, moderator or admin). Admin only. The user's access tokens are revoked so the old role stops working at once; the last admin can't be demoted.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param userId path string true "User ID"
+// @Param body body repository.UserRoleRequest true "Role"
+// @Success 200 {object} repository.UserRoleResponse
+// @Router /users/{userId}/role [put]
+func (controller *UserController) AssignRole(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	targetId := ctx.Param("userId")
+	roleReq := repository.UserRoleRequest{}
+	var user models.User
+
+	err = ctx.ShouldBindJSON(&roleReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	if !auth.ValidRole(roleReq.Role) {
+		response.BadRequestResponse(ctx, "Role must be one of user, moderator or admin")
+		return
+	}
+
+	err = controller.db.First(&user, targetId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if !principal.Can(auth.ActionAssignRole, auth.ResourceUser, user.Id) {
+		response.WriteJsonResponse(ctx, http.StatusForbidden, gin.H{
+			"error":   true,
+			"message": "you're not allowed to change this user's role",
+		})
+		return
+	}
+
+	if user.Role == roleReq.Role {
+		response.WriteJsonResponse(ctx, http.StatusOK, repository.UserRoleResponse{
+			Id:       user.Id,
+			Username: user.Username,
+			Role:     user.Role,
+		})
+		return
+	}
+
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		if user.Role == auth.RoleAdmin {
+			// locking every admin row serializes concurrent demotions, so two admins can't demote each other
+			var adminIds []uint
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Model(&models.User{}).
+				Where("role = ?", auth.RoleAdmin).Pluck("id", &adminIds).Error
+			if err != nil {
+				return err
+			}
+			if len(adminIds) <= 1 {
+				return errLastAdmin
+			}
+		}
+		return tx.Model(&user).Update("role", roleReq.Role).Error
+	})
+	if err != nil {
+		if errors.Is(err, errLastAdmin) {
+			response.WriteJsonResponse(ctx, http.StatusConflict, gin.H{
+				"error":   true,
+				"code":    "last_admin",
+				"message": err.Error(),
+			})
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// tokens carry the roles they were issued with, so the old role has to stop working now;
+	// a refresh picks up the new one
+	err = controller.revocations.RevokeUser(user.Id)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserRoleResponse{
+		Id:       user.Id,
+		Username: user.Username,
+		Role:     user.Role,
+	})
+}
+
+var errLastAdmin = errors.New("the last admin can't be demoted, promote another user first")
+
+// ForgotPassword godoc
+// @Summary Request a password reset link
+// @Description Email a single-use password reset link. The response is the same whether or not the email is registered.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserForgotPasswordRequest true "Account email"
+// @Success 200 {object} gin.H
+// @Router /users/password/forgot [post]
+func (controller *UserController) ForgotPassword(ctx *gin.Context) {
+	forgotReq := repository.UserForgotPasswordRequest{}
+	err := ctx.ShouldBindJSON(&forgotReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&forgotReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+	err = controller.db.Where("email = ?", forgotReq.Email).Take(&user).Error
+	if err == nil {
+		err = controller.sendPasswordReset(user)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		// the caller gets the same answer either way so the endpoint can't be used to probe accounts
+		log.Println("password reset:", err)
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "If the email is registered, a password reset link has been sent",
+	})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using the token from the reset email. Every existing session is logged out.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} gin.H
+// @Router /users/password/reset [post]
+func (controller *UserController) ResetPassword(ctx *gin.Context) {
+	resetReq := repository.UserResetPasswordRequest{}
+	err := ctx.ShouldBindJSON(&resetReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&resetReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	// the token is only used up once the new password is accepted, so a rejected password can be retried
+	userToken, err := controller.userTokens.Peek(resetReq.Token, models.TokenPurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) || errors.Is(err, repository.ErrUserTokenExpired) {
+			response.BadRequestResponse(ctx, err.Error())
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+	err = controller.db.First(&user, userToken.UserId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.BadRequestResponse(ctx, repository.ErrUserTokenInvalid.Error())
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if !controller.checkPassword(ctx, "password", resetReq.Password, user.Username, user.Email) {
+		return
+	}
+
+	userToken, err = controller.userTokens.Consume(resetReq.Token, models.TokenPurposePasswordReset)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) || errors.Is(err, repository.ErrUserTokenExpired) {
+			response.BadRequestResponse(ctx, err.Error())
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.setPassword(userToken.UserId, resetReq.Password)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "Your password has been reset, please log in again",
+	})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm ownership of the account email using the token from the verification link
+// @Tags users
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} gin.H
+// @Router /users/email/verify [get]
+func (controller *UserController) VerifyEmail(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		response.BadRequestResponse(ctx, "Verification token is required")
+		return
+	}
+
+	userToken, err := controller.userTokens.Consume(token, models.TokenPurposeEmailVerification)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) || errors.Is(err, repository.ErrUserTokenExpired) {
+			response.BadRequestResponse(ctx, err.Error())
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.Model(&models.User{}).Where("id = ?", userToken.UserId).Update("email_verified_at", time.Now()).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "Your email has been verified",
+	})
+}
+
+// ResendEmailVerification godoc
+// @Summary Resend verification email
+// @Description Send a new verification link to the authenticated user's email
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/email/verification [post]
+func (controller *UserController) ResendEmailVerification(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		response.BadRequestResponse(ctx, "Your email is already verified")
+		return
+	}
+
+	err = controller.sendEmailVerification(user)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "A verification link has been sent to your email",
+	})
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Change the password of the authenticated user. Every other session is logged out and a fresh token pair is returned for this one.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body repository.UserChangePasswordRequest true "Current and new password"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /users/password [put]
+func (controller *UserController) ChangePassword(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	changeReq := repository.UserChangePasswordRequest{}
+	var user models.User
+
+	err = ctx.ShouldBindJSON(&changeReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&changeReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if !auth.ComparePassword(user.Password, changeReq.CurrentPassword) {
+		response.UnauthorizedResponse(ctx, "current password is not match")
+		return
+	}
+
+	if !controller.checkPassword(ctx, "new_password", changeReq.NewPassword, user.Username, user.Email) {
+		return
+	}
+
+	err = controller.setPassword(user.Id, changeReq.NewPassword)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// setPassword ended every session including this one, so hand the caller a new one
+	controller.startSession(ctx, user)
+}
+
+func (controller *UserController) sendEmailVerification(user models.User) error {
+	ttl := config.Duration("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	token, err := controller.userTokens.Issue(user.Id, models.TokenPurposeEmailVerification, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := config.Get("EMAIL_VERIFICATION_URL", "http://localhost:8080/users/email/verify") + "?token=" + url.QueryEscape(token)
+	return controller.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your MyGRAM email",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that %s is your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Username, user.Email, ttl, link),
+	})
+}
+
+func (controller *UserController) sendPasswordReset(user models.User) error {
+	ttl := config.Duration("PASSWORD_RESET_TTL", time.Hour)
+	token, err := controller.userTokens.Issue(user.Id, models.TokenPurposePasswordReset, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := config.Get("PASSWORD_RESET_URL", "http://localhost:8080/password/reset") + "?token=" + url.QueryEscape(token)
+	return controller.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your MyGRAM password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, ttl, link),
+	})
+}
+
+// setPassword rehashes and stores a new password, then logs the user out everywhere.
+func (controller *UserController) setPassword(userId uint, password string) error {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = controller.db.Model(&models.User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"password":            hash,
+		"password_changed_at": time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	return controller.revokeAllTokens(userId)
+}
+
+// checkPassword applies the password policy and writes a field-level error when password breaks it.
+func (controller *UserController) checkPassword(ctx *gin.Context, field, password string, personal ...string) bool {
+	problems := controller.passwords.Check(password, personal...)
+	if len(problems) == 0 {
+		return true
+	}
+
+	response.ValidationErrorResponse(ctx, map[string][]string{
+		field: problems,
+	})
+	return false
+}
+
+// rehashPassword replaces a stored hash with one from the current hasher. Failing is not fatal to
+// the login; the upgrade is simply tried again next time.
+func (controller *UserController) rehashPassword(user models.User, password string) {
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		log.Println("password rehash:", err)
+		return
+	}
+
+	// matching the old hash keeps this from overwriting a password changed in the meantime
+	err = controller.db.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.Id, user.Password).
+		Update("password", hash).Error
+	if err != nil {
+		log.Println("password rehash:", err)
+	}
+}
+
+// revokeAllTokens kills every session of the user, both access and refresh tokens.
+func (controller *UserController) revokeAllTokens(userId uint) error {
+	if err := controller.revocations.RevokeUser(userId); err != nil {
+		return err
+	}
+	if err := controller.sessions.TerminateUser(userId); err != nil {
+		return err
+	}
+	return controller.refreshTokens.RevokeUser(userId)
+}
+
+// endSession terminates one session and its refresh tokens.
+func (controller *UserController) endSession(familyId string) error {
+	if err := controller.sessions.TerminateFamily(familyId); err != nil {
+		return err
+	}
+	return controller.refreshTokens.RevokeFamily(familyId)
+}
+
+// startSession records a new session for the user on this device and responds with its token pair.
+func (controller *UserController) startSession(ctx *gin.Context, user models.User) {
+	refreshToken, familyId, err := controller.refreshTokens.Issue(user.Id)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = controller.sessions.Create(user.Id, familyId, ctx.Request.UserAgent(), ctx.ClientIP())
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	controller.writeTokenPair(ctx, user, refreshToken, familyId)
+}
+
+// writeTokenPair mints an access token for the user and responds with it alongside refreshToken.
+func (controller *UserController) writeTokenPair(ctx *gin.Context, user models.User, refreshToken string, sessionId string) {
+	token, err := auth.GenerateToken(user.Id, user.Email, user.Roles(), sessionId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
 	ctx.JSON(http.StatusOK, repository.UserLoginResponse{
-		Token: token,
+		Token:        token,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(auth.AccessTokenTTL().Seconds()),
 	})
 }
 
@@ -116,11 +825,16 @@ func (controller *UserController) UserLogin(ctx *gin.Context) {
 // @Success 200 {object} UserUpdateResponse
 // @Router /users/{id} [put]
 func (controller *UserController) UpdateUser(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	userReq := repository.UserUpdateRequest{}
 	user := models.User{}
 
-	err := ctx.ShouldBindJSON(&userReq)
+	err = ctx.ShouldBindJSON(&userReq)
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
@@ -137,7 +851,7 @@ func (controller *UserController) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
-	err = controller.db.First(&user, userId).Error
+	err = controller.db.First(&user, principal.UserId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "User data not found")
@@ -147,12 +861,24 @@ func (controller *UserController) UpdateUser(ctx *gin.Context) {
 		return
 	}
 
+	previousEmail := user.Email
 	err = controller.db.Model(&user).Updates(updatedUser).Error
 	if err != nil {
 		response.BadRequestResponse(ctx, err.Error())
 		return
 	}
 
+	if user.Email != previousEmail {
+		err = controller.db.Model(&user).Update("email_verified_at", nil).Error
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+		if err := controller.sendEmailVerification(user); err != nil {
+			log.Println("email verification:", err)
+		}
+	}
+
 	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserUpdateResponse{
 		Id:        user.Id,
 		Username:  user.Username,
@@ -170,10 +896,15 @@ func (controller *UserController) UpdateUser(ctx *gin.Context) {
 // @Success 200 {object} gin.H
 // @Router /users [delete]
 func (controller *UserController) DeleteUser(ctx *gin.Context) {
-	userId, _ := ctx.Get("id")
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
 	var user models.User
 
-	err := controller.db.First(&user, userId).Error
+	err = controller.db.First(&user, principal.UserId).Error
 	if err != nil {
 		if err.Error() == gorm.ErrRecordNotFound.Error() {
 			response.NotFoundResponse(ctx, "User not found")
@@ -183,12 +914,60 @@ func (controller *UserController) DeleteUser(ctx *gin.Context) {
 		return
 	}
 
-	err = controller.db.Delete(&user).Error
+	err = controller.revokeAllTokens(user.Id)
 	if err != nil {
-		if err.Error() == gorm.ErrRecordNotFound.Error() {
-			response.NotFoundResponse(ctx, err.Error())
-			return
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// the rows below reference the user, so they go first and together with it: a failure
+	// halfway must not leave an account that can no longer log in but was never deleted
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.RefreshToken{},
+			&models.UserToken{},
+			&models.RecoveryCode{},
+			&models.ApiKey{},
+			&models.Session{},
+			&models.Identity{},
+			&models.Passkey{},
+			&models.WebAuthnChallenge{},
+			&models.CommentReaction{},
+		} {
+			if err := tx.Where("user_id = ?", user.Id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("follower_id = ? OR following_id = ?", user.Id, user.Id).Delete(&models.Follow{}).Error; err != nil {
+			return err
 		}
+
+		if err := tx.Where("user_id = ? OR author_id = ?", user.Id, user.Id).Delete(&models.TimelineEntry{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("requester_id = ? OR target_id = ?", user.Id, user.Id).Delete(&models.FollowRequest{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", user.Id, user.Id).Delete(&models.Block{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("muter_id = ? OR muted_id = ?", user.Id, user.Id).Delete(&models.Mute{}).Error; err != nil {
+			return err
+		}
+
+		// taking the likes back lowers the counts of the photos they were on in the same statement
+		err := tx.Exec(`WITH removed AS (DELETE FROM likes WHERE user_id = ? RETURNING photo_id)
+			UPDATE photos SET like_count = like_count - 1 WHERE id IN (SELECT photo_id FROM removed)`, user.Id).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&user).Error
+	})
+	if err != nil {
 		response.InternalServerJsonResponse(ctx, err.Error())
 		return
 	}
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/mailer"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+)
+
+// RequestMagicLink godoc
+// @Summary Request a magic login link
+// @Description Email a single-use, short-lived login link. The response is the same whether or not the email is registered. Requests are throttled per email and per client IP.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserMagicLinkRequest true "Account email"
+// @Success 200 {object} gin.H
+// @Router /users/magic-link [post]
+func (controller *UserController) RequestMagicLink(ctx *gin.Context) {
+	magicReq := repository.UserMagicLinkRequest{}
+	err := ctx.ShouldBindJSON(&magicReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&magicReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	// every request counts, so a throttled email looks the same whether or not it is registered
+	account := strings.ToLower(magicReq.Email)
+	retryAfter, err := controller.magicLinkLimiter.Check(account, ctx.ClientIP())
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if retryAfter > 0 {
+		response.TooManyRequestsResponse(ctx, retryAfter, "too many login links requested, try again later")
+		return
+	}
+	if _, err := controller.magicLinkLimiter.Fail(account, ctx.ClientIP()); err != nil {
+		log.Println("magic link limiter:", err)
+	}
+
+	var user models.User
+	err = controller.db.Where("email = ?", magicReq.Email).Take(&user).Error
+	if err == nil {
+		err = controller.sendMagicLink(user)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println("magic link:", err)
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "If the email is registered, a login link has been sent",
+	})
+}
+
+var magicLinkPage = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="referrer" content="no-referrer"><title>Log in to MyGRAM</title></head>
+<body>
+<form method="post" action="">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Log in to MyGRAM</button>
+</form>
+</body>
+</html>
+`))
+
+// MagicLinkConfirm godoc
+// @Summary Confirm a magic link login
+// @Description The page the emailed link opens. It only shows a button that POSTs the token, so mail scanners and link previews that fetch the link don't use it up.
+// @Tags users
+// @Produce html
+// @Param token query string true "Magic link token"
+// @Success 200 {string} string
+// @Router /users/magic-link/verify [get]
+func (controller *UserController) MagicLinkConfirm(ctx *gin.Context) {
+	verifyReq := repository.UserMagicLinkVerifyRequest{}
+	err := ctx.ShouldBindQuery(&verifyReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&verifyReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	var page bytes.Buffer
+	if err := magicLinkPage.Execute(&page, verifyReq.Token); err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Header("Referrer-Policy", "no-referrer")
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// MagicLinkLogin godoc
+// @Summary Log in with a magic link
+// @Description Exchange the token from a magic link email for a token pair. Accepts a JSON body or the form posted by the confirmation page.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserMagicLinkVerifyRequest true "Magic link token"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /users/magic-link/verify [post]
+func (controller *UserController) MagicLinkLogin(ctx *gin.Context) {
+	verifyReq := repository.UserMagicLinkVerifyRequest{}
+	err := ctx.ShouldBind(&verifyReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&verifyReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	userToken, err := controller.userTokens.Consume(verifyReq.Token, models.TokenPurposeMagicLink)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserTokenInvalid) || errors.Is(err, repository.ErrUserTokenExpired) {
+			response.UnauthorizedResponse(ctx, err.Error())
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+	err = controller.db.First(&user, userToken.UserId).Error
+	if err != nil {
+		response.UnauthorizedResponse(ctx, "User not found")
+		return
+	}
+
+	// opening the link proves the user controls the mailbox it was sent to, which only verifies the
+	// email if the user hasn't changed it since
+	if user.EmailVerifiedAt == nil && strings.EqualFold(userToken.Email, user.Email) {
+		now := time.Now()
+		err = controller.db.Model(&user).Update("email_verified_at", now).Error
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+	}
+
+	if user.TotpEnabledAt != nil {
+		controller.writeMfaChallenge(ctx, user)
+		return
+	}
+
+	controller.startSession(ctx, user)
+}
+
+func (controller *UserController) sendMagicLink(user models.User) error {
+	ttl := config.Duration("MAGIC_LINK_TTL", 15*time.Minute)
+	token, err := controller.userTokens.IssueForEmail(user.Id, user.Email, models.TokenPurposeMagicLink, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := config.Get("MAGIC_LINK_URL", "http://localhost:8080/users/magic-link/verify") + "?token=" + url.QueryEscape(token)
+	return controller.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your MyGRAM login link",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to log in to MyGRAM. It expires in %s and can only be used once.\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n",
+			user.Username, ttl, link),
+	})
+}
@@ -0,0 +1,392 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// EnrollMfa godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the authenticated user. Two-factor is not active until confirmed.
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.UserMfaEnrollResponse
+// @Router /users/2fa/enroll [post]
+func (controller *UserController) EnrollMfa(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if user.TotpEnabledAt != nil {
+		response.BadRequestResponse(ctx, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserMfaEnrollResponse{
+		Secret:     secret,
+		OtpauthUri: auth.TOTPURI(config.Get("TOTP_ISSUER", "MyGRAM"), user.Email, secret),
+	})
+}
+
+// ConfirmMfa godoc
+// @Summary Confirm two-factor enrollment
+// @Description Activate two-factor with a code from the authenticator app. Returns one-time recovery codes that are only shown once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body repository.UserMfaConfirmRequest true "TOTP code"
+// @Success 200 {object} repository.UserMfaConfirmResponse
+// @Router /users/2fa/confirm [post]
+func (controller *UserController) ConfirmMfa(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	confirmReq := repository.UserMfaConfirmRequest{}
+	var user models.User
+
+	err = ctx.ShouldBindJSON(&confirmReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&confirmReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if user.TotpEnabledAt != nil {
+		response.BadRequestResponse(ctx, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TotpSecret == "" {
+		response.BadRequestResponse(ctx, "Start two-factor enrollment first")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TotpSecret, confirmReq.Code, time.Now())
+	if !ok {
+		response.BadRequestResponse(ctx, "Invalid two-factor code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.Id, codes)
+	})
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserMfaConfirmResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableMfa godoc
+// @Summary Disable two-factor authentication
+// @Description Turn off two-factor. Requires the current password and a TOTP or recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body repository.UserMfaDisableRequest true "Password and code"
+// @Success 200 {object} gin.H
+// @Router /users/2fa/disable [post]
+func (controller *UserController) DisableMfa(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	disableReq := repository.UserMfaDisableRequest{}
+	var user models.User
+
+	err = ctx.ShouldBindJSON(&disableReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&disableReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if user.TotpEnabledAt == nil {
+		response.BadRequestResponse(ctx, "Two-factor authentication is not enabled")
+		return
+	}
+
+	if !auth.ComparePassword(user.Password, disableReq.Password) {
+		response.UnauthorizedResponse(ctx, "password is not match")
+		return
+	}
+
+	ok, err := controller.verifySecondFactor(user, disableReq.Code)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if !ok {
+		response.UnauthorizedResponse(ctx, "Invalid two-factor code")
+		return
+	}
+
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.Id).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"message": "Two-factor authentication has been disabled",
+	})
+}
+
+// MfaLogin godoc
+// @Summary Complete login with a second factor
+// @Description Exchange the mfa_token from /users/login and a TOTP or recovery code for a token pair
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.UserMfaLoginRequest true "MFA token and code"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /users/login/mfa [post]
+func (controller *UserController) MfaLogin(ctx *gin.Context) {
+	mfaReq := repository.UserMfaLoginRequest{}
+	var user models.User
+
+	err := ctx.ShouldBindJSON(&mfaReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&mfaReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	claims, err := auth.VerifyMfaToken(mfaReq.MfaToken)
+	if err != nil {
+		code := "token_invalid"
+		if errors.Is(err, auth.ErrTokenExpired) {
+			code = "token_expired"
+		}
+		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
+			"error":   true,
+			"code":    code,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	userId, err := auth.ClaimUserId(claims)
+	if err != nil || jti == "" {
+		response.WriteJsonResponse(ctx, http.StatusUnauthorized, gin.H{
+			"error":   true,
+			"code":    "token_invalid",
+			"message": auth.ErrMalformedClaims.Error(),
+		})
+		return
+	}
+
+	revoked, err := controller.revocations.IsRevoked(jti, userId, auth.ClaimTime(claims, "iat"))
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if revoked {
+		response.UnauthorizedResponse(ctx, "mfa token has already been used")
+		return
+	}
+
+	err = controller.db.First(&user, userId).Error
+	if err != nil || user.TotpEnabledAt == nil {
+		response.UnauthorizedResponse(ctx, "UNAUTHORIZED")
+		return
+	}
+
+	// six digit codes are easy to guess, so the second step is throttled like the first
+	account := fmt.Sprintf("mfa:%d", user.Id)
+	retryAfter, err := controller.loginLimiter.Check(account, ctx.ClientIP())
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if retryAfter > 0 {
+		controller.recordLoginFailure(ctx, user.Email, &user.Id, "mfa_throttled")
+		response.TooManyRequestsResponse(ctx, retryAfter, "too many failed attempts, try again later")
+		return
+	}
+
+	ok, err := controller.verifySecondFactor(user, mfaReq.Code)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if !ok {
+		controller.failLogin(ctx, account, user.Email, &user.Id, "wrong_mfa_code")
+		response.UnauthorizedResponse(ctx, "Invalid two-factor code")
+		return
+	}
+
+	err = controller.loginLimiter.Succeed(account)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// the pending token is single-use
+	err = controller.revocations.RevokeToken(jti, user.Id, auth.ClaimTime(claims, "exp"))
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	controller.startSession(ctx, user)
+}
+
+// writeMfaChallenge answers the first login step for users with two-factor enabled.
+func (controller *UserController) writeMfaChallenge(ctx *gin.Context, user models.User) {
+	mfaToken, err := auth.GenerateMfaToken(user.Id)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserMfaRequiredResponse{
+		MfaRequired: true,
+		MfaToken:    mfaToken,
+		ExpiresIn:   int64(auth.MfaTokenTTL().Seconds()),
+	})
+}
+
+// verifySecondFactor accepts either a TOTP code that has not been used before or an unused recovery code.
+func (controller *UserController) verifySecondFactor(user models.User, code string) (bool, error) {
+	if step, ok := auth.ValidateTOTP(user.TotpSecret, code, time.Now()); ok {
+		// only move forward in time, so a code that was already accepted can't be replayed
+		result := controller.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.Id, step).
+			Update("totp_last_step", step)
+		return result.RowsAffected > 0, result.Error
+	}
+
+	result := controller.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.Id, auth.HashToken(auth.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId uint, codes []string) error {
+	err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+
+	recoveryCodes := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		recoveryCodes = append(recoveryCodes, models.RecoveryCode{
+			UserId:   userId,
+			CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+		})
+	}
+	return tx.Create(&recoveryCodes).Error
+}
@@ -0,0 +1,442 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/oidc"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	// oidcStateCookie holds the state in the browser that started the flow, so a callback URL
+	// carrying someone else's state (login CSRF) is refused
+	oidcStateCookie = "oidc_state"
+)
+
+var usernameCleaner = regexp.MustCompile(`[^a-zA-Z0-9_.]+`)
+
+// OidcLogin godoc
+// @Summary Log in with OpenID Connect
+// @Description Redirect to the configured OpenID Connect provider (authorization code flow with PKCE)
+// @Tags auth
+// @Success 302
+// @Router /auth/oidc/login [get]
+func (controller *UserController) OidcLogin(ctx *gin.Context) {
+	authorizationUrl, err := controller.beginOidc(ctx, nil)
+	if err != nil {
+		controller.writeOidcError(ctx, err)
+		return
+	}
+
+	ctx.Redirect(http.StatusFound, authorizationUrl)
+}
+
+// LinkOidcIdentity godoc
+// @Summary Link an OpenID Connect identity
+// @Description Start linking an account at the OpenID Connect provider to the authenticated user. The response sets the state cookie, so open the authorization URL in the same browser.
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.UserOidcAuthorizeResponse
+// @Router /users/identities/oidc [post]
+func (controller *UserController) LinkOidcIdentity(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	linkUserId := principal.UserId
+
+	authorizationUrl, err := controller.beginOidc(ctx, &linkUserId)
+	if err != nil {
+		controller.writeOidcError(ctx, err)
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.UserOidcAuthorizeResponse{
+		AuthorizationUrl: authorizationUrl,
+	})
+}
+
+// OidcCallback godoc
+// @Summary OpenID Connect callback
+// @Description Finish the OpenID Connect flow. Logs in (creating the user on first login when the provider verified the email) or links the identity.
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /auth/oidc/callback [get]
+func (controller *UserController) OidcCallback(ctx *gin.Context) {
+	if controller.oidc == nil {
+		controller.writeOidcError(ctx, oidc.ErrNotConfigured)
+		return
+	}
+
+	if providerError := ctx.Query("error"); providerError != "" {
+		response.BadRequestResponse(ctx, providerError+": "+ctx.Query("error_description"))
+		return
+	}
+
+	code := ctx.Query("code")
+	stateToken := ctx.Query("state")
+	if code == "" || stateToken == "" {
+		response.BadRequestResponse(ctx, "code and state are required")
+		return
+	}
+
+	// the state has to come back to the browser it was issued to before it is spent
+	cookieState, err := ctx.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookieState), []byte(stateToken)) != 1 {
+		response.BadRequestResponse(ctx, "state does not belong to this browser")
+		return
+	}
+	controller.setOidcStateCookie(ctx, "", -1)
+
+	// deleting the state while reading it makes every state single-use
+	var state models.OidcState
+	result := controller.db.Clauses(clause.Returning{}).
+		Where("state_hash = ? AND expires_at > ?", auth.HashToken(stateToken), time.Now()).
+		Delete(&state)
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.BadRequestResponse(ctx, "state is invalid or has expired")
+		return
+	}
+
+	claims, err := controller.oidc.Exchange(code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var identity models.Identity
+	err = controller.db.Where("provider = ? AND subject = ?", controller.oidc.Name, claims.Subject).Take(&identity).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	found := err == nil
+
+	if state.LinkUserId != nil {
+		if found {
+			if identity.UserId == *state.LinkUserId {
+				response.BadRequestResponse(ctx, "This identity is already linked to your account")
+				return
+			}
+			response.WriteJsonResponse(ctx, http.StatusConflict, gin.H{
+				"error":   true,
+				"message": "This identity is already linked to another account",
+			})
+			return
+		}
+
+		identity = models.Identity{
+			UserId:   *state.LinkUserId,
+			Provider: controller.oidc.Name,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}
+		err = controller.db.Create(&identity).Error
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+
+		response.WriteJsonResponse(ctx, http.StatusOK, identityResponse(identity))
+		return
+	}
+
+	var user models.User
+	if found {
+		err = controller.db.First(&user, identity.UserId).Error
+	} else {
+		user, err = controller.provisionOidcUser(claims)
+	}
+	if err != nil {
+		if errors.Is(err, errOidcEmailTaken) {
+			response.WriteJsonResponse(ctx, http.StatusConflict, gin.H{
+				"error":   true,
+				"message": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, errOidcEmailUnverified) {
+			response.WriteJsonResponse(ctx, http.StatusForbidden, gin.H{
+				"error":   true,
+				"message": err.Error(),
+			})
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if user.TotpEnabledAt != nil {
+		controller.writeMfaChallenge(ctx, user)
+		return
+	}
+
+	controller.startSession(ctx, user)
+}
+
+// FindAllIdentity godoc
+// @Summary List linked identities
+// @Description List the external identities linked to the authenticated user
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} repository.UserIdentityResponse
+// @Router /users/identities [get]
+func (controller *UserController) FindAllIdentity(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var identities []models.Identity
+
+	err = controller.db.Where("user_id = ?", principal.UserId).Order("id").Find(&identities).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	identityList := make([]repository.UserIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		identityList = append(identityList, identityResponse(identity))
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, identityList)
+}
+
+// DeleteIdentity godoc
+// @Summary Unlink an identity
+// @Description Unlink an external identity from the authenticated user
+// @Tags users
+// @Produce json
+// @Param identityId path string true "Identity ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/identities/{identityId} [delete]
+func (controller *UserController) DeleteIdentity(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	identityId, err := strconv.ParseUint(ctx.Param("identityId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid identity ID")
+		return
+	}
+
+	result := controller.db.Where("id = ? AND user_id = ?", identityId, principal.UserId).Delete(&models.Identity{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "data not found")
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "The identity has been successfully unlinked",
+	})
+}
+
+var (
+	errOidcEmailTaken      = errors.New("an account with this email already exists, log in and link the identity from your account instead")
+	errOidcEmailUnverified = errors.New("the provider has not verified this email address, register with it instead and link the identity from your account")
+)
+
+// beginOidc stores a new state, binds it to the browser with a cookie and returns the provider authorization URL.
+func (controller *UserController) beginOidc(ctx *gin.Context, linkUserId *uint) (string, error) {
+	if controller.oidc == nil {
+		return "", oidc.ErrNotConfigured
+	}
+
+	stateToken, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := auth.GenerateOpaqueToken(16)
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+
+	err = controller.db.Where("expires_at < ?", time.Now()).Delete(&models.OidcState{}).Error
+	if err != nil {
+		return "", err
+	}
+
+	err = controller.db.Create(&models.OidcState{
+		StateHash:    auth.HashToken(stateToken),
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		LinkUserId:   linkUserId,
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+
+	controller.setOidcStateCookie(ctx, stateToken, int(oidcStateTTL.Seconds()))
+	return controller.oidc.AuthCodeURL(stateToken, nonce, oidc.CodeChallengeS256(verifier))
+}
+
+// setOidcStateCookie scopes the state cookie to the callback. SameSite=Lax still sends it on the
+// provider's top-level redirect back; an empty value with a negative maxAge clears it.
+func (controller *UserController) setOidcStateCookie(ctx *gin.Context, stateToken string, maxAge int) {
+	path, secure := "/", false
+	if callback, err := url.Parse(controller.oidc.RedirectURL); err == nil {
+		path, secure = callback.Path, callback.Scheme == "https"
+	}
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(oidcStateCookie, stateToken, maxAge, path, "", secure, true)
+}
+
+// provisionOidcUser creates a user for an identity seen for the first time. Accounts are never
+// merged by email: an existing user has to link the identity explicitly. The email has to be
+// verified by the provider, otherwise the account would hold an address nobody proved they own.
+func (controller *UserController) provisionOidcUser(claims *oidc.Claims) (models.User, error) {
+	var user models.User
+	if claims.Email == "" {
+		return user, errors.New("the provider did not share an email address")
+	}
+	if !claims.EmailVerified {
+		return user, errOidcEmailUnverified
+	}
+
+	var count int64
+	err := controller.db.Model(&models.User{}).Where("email = ?", claims.Email).Count(&count).Error
+	if err != nil {
+		return user, err
+	}
+	if count > 0 {
+		return user, errOidcEmailTaken
+	}
+
+	username, err := controller.uniqueUsername(claims)
+	if err != nil {
+		return user, err
+	}
+
+	// the account can only be reached through the provider until the user sets a password with a reset
+	randomPassword, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return user, err
+	}
+	hash, err := auth.HashPassword(randomPassword)
+	if err != nil {
+		return user, err
+	}
+
+	now := time.Now()
+	user = models.User{
+		Username:        username,
+		Email:           claims.Email,
+		Password:        hash,
+		Role:            auth.RoleUser,
+		EmailVerifiedAt: &now,
+	}
+
+	err = controller.db.Transaction(func(tx *gorm.DB) error {
+		// BeforeCreate would validate a registration form (age, plain password), which doesn't apply here
+		err := tx.Session(&gorm.Session{SkipHooks: true}).Create(&user).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.Identity{
+			UserId:   user.Id,
+			Provider: controller.oidc.Name,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return user, err
+	}
+
+	log.Printf("provisioned user %d from %s identity", user.Id, controller.oidc.Name)
+	return user, nil
+}
+
+func (controller *UserController) uniqueUsername(claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base = strings.Split(claims.Email, "@")[0]
+	}
+	base = usernameCleaner.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 10; attempt++ {
+		var count int64
+		err := controller.db.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count == 0 && !repository.IsReservedUsername(candidate) {
+			return candidate, nil
+		}
+
+		suffix, err := auth.GenerateOpaqueToken(3)
+		if err != nil {
+			return "", err
+		}
+		candidate = fmt.Sprintf("%s_%s", base, usernameCleaner.ReplaceAllString(suffix, ""))
+	}
+
+	return "", errors.New("could not find a free username")
+}
+
+func (controller *UserController) writeOidcError(ctx *gin.Context, err error) {
+	if errors.Is(err, oidc.ErrNotConfigured) {
+		response.NotFoundResponse(ctx, err.Error())
+		return
+	}
+	response.InternalServerJsonResponse(ctx, err.Error())
+}
+
+func identityResponse(identity models.Identity) repository.UserIdentityResponse {
+	return repository.UserIdentityResponse{
+		Id:        identity.Id,
+		Provider:  identity.Provider,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+}
@@ -0,0 +1,468 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BeginPasskeyRegistration godoc
+// @Summary Start passkey registration
+// @Description Create the options for navigator.credentials.create(). Binary fields are base64url encoded.
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} repository.PasskeyRegisterOptionsResponse
+// @Router /users/passkeys/register/begin [post]
+func (controller *UserController) BeginPasskeyRegistration(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var user models.User
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	var passkeys []models.Passkey
+	err = controller.db.Where("user_id = ?", user.Id).Find(&passkeys).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	challenge, err := controller.createWebAuthnChallenge(models.WebAuthnPurposeRegistration, &user.Id)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	params := make([]repository.PasskeyCredentialParam, 0, len(auth.WebAuthnAlgorithms))
+	for _, alg := range auth.WebAuthnAlgorithms {
+		params = append(params, repository.PasskeyCredentialParam{Type: "public-key", Alg: alg})
+	}
+
+	// the authenticator refuses to create a second credential for the same account
+	exclude := make([]repository.PasskeyCredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, repository.PasskeyCredentialDescriptor{Type: "public-key", Id: passkey.CredentialId})
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.PasskeyRegisterOptionsResponse{
+		Challenge: challenge,
+		Rp: repository.PasskeyRelyingParty{
+			Id:   controller.relyingParty.Id,
+			Name: controller.relyingParty.Name,
+		},
+		User: repository.PasskeyUser{
+			Id:          auth.EncodeWebAuthnData(auth.WebAuthnUserHandle(user.Id)),
+			Name:        user.Email,
+			DisplayName: user.Username,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            controller.relyingParty.Timeout.Milliseconds(),
+		Attestation:        "none",
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: repository.PasskeyAuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: controller.userVerification(),
+		},
+	})
+}
+
+// FinishPasskeyRegistration godoc
+// @Summary Finish passkey registration
+// @Description Verify the credential returned by navigator.credentials.create() and store its public key
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body repository.PasskeyRegisterRequest true "Credential"
+// @Success 201 {object} repository.PasskeyResponse
+// @Router /users/passkeys/register/finish [post]
+func (controller *UserController) FinishPasskeyRegistration(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	registerReq := repository.PasskeyRegisterRequest{}
+
+	err = ctx.ShouldBindJSON(&registerReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&registerReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	clientDataJSON, err := auth.DecodeWebAuthnData(registerReq.Response.ClientDataJSON)
+	if err != nil {
+		response.BadRequestResponse(ctx, "clientDataJSON is not valid base64url")
+		return
+	}
+	attestationObject, err := auth.DecodeWebAuthnData(registerReq.Response.AttestationObject)
+	if err != nil {
+		response.BadRequestResponse(ctx, "attestationObject is not valid base64url")
+		return
+	}
+
+	challenge, err := controller.consumeWebAuthnChallenge(clientDataJSON, models.WebAuthnPurposeRegistration, &principal.UserId)
+	if err != nil {
+		controller.writeWebAuthnError(ctx, http.StatusBadRequest, err)
+		return
+	}
+
+	credential, err := controller.relyingParty.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	requestedId, err := auth.DecodeWebAuthnData(registerReq.Id)
+	if err != nil || !bytes.Equal(requestedId, credential.Id) {
+		response.BadRequestResponse(ctx, "Credential id does not match the attested credential")
+		return
+	}
+	credentialId := auth.EncodeWebAuthnData(credential.Id)
+
+	var existing int64
+	err = controller.db.Model(&models.Passkey{}).Where("credential_id = ?", credentialId).Count(&existing).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if existing > 0 {
+		response.WriteJsonResponse(ctx, http.StatusConflict, gin.H{
+			"error":   true,
+			"message": "This passkey is already registered",
+		})
+		return
+	}
+
+	passkey := models.Passkey{
+		UserId:       principal.UserId,
+		Name:         registerReq.Name,
+		CredentialId: credentialId,
+		PublicKey:    credential.PublicKey,
+		Algorithm:    credential.Algorithm,
+		SignCount:    credential.SignCount,
+		Aaguid:       auth.EncodeWebAuthnData(credential.Aaguid),
+	}
+	err = controller.db.Create(&passkey).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusCreated, passkeyResponse(passkey))
+}
+
+// BeginPasskeyLogin godoc
+// @Summary Start passkey login
+// @Description Create the options for navigator.credentials.get(). Any passkey registered for this site can answer.
+// @Tags users
+// @Produce json
+// @Success 200 {object} repository.PasskeyLoginOptionsResponse
+// @Router /users/passkeys/login/begin [post]
+func (controller *UserController) BeginPasskeyLogin(ctx *gin.Context) {
+	challenge, err := controller.createWebAuthnChallenge(models.WebAuthnPurposeLogin, nil)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, repository.PasskeyLoginOptionsResponse{
+		Challenge:        challenge,
+		RpId:             controller.relyingParty.Id,
+		Timeout:          controller.relyingParty.Timeout.Milliseconds(),
+		UserVerification: controller.userVerification(),
+		AllowCredentials: []repository.PasskeyCredentialDescriptor{},
+	})
+}
+
+// FinishPasskeyLogin godoc
+// @Summary Log in with a passkey
+// @Description Verify the assertion returned by navigator.credentials.get() and return a token pair
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param body body repository.PasskeyLoginRequest true "Assertion"
+// @Success 200 {object} repository.UserLoginResponse
+// @Router /users/passkeys/login/finish [post]
+func (controller *UserController) FinishPasskeyLogin(ctx *gin.Context) {
+	loginReq := repository.PasskeyLoginRequest{}
+
+	err := ctx.ShouldBindJSON(&loginReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&loginReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	credentialId, err := auth.DecodeWebAuthnData(loginReq.Id)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Credential id is not valid base64url")
+		return
+	}
+	clientDataJSON, err := auth.DecodeWebAuthnData(loginReq.Response.ClientDataJSON)
+	if err != nil {
+		response.BadRequestResponse(ctx, "clientDataJSON is not valid base64url")
+		return
+	}
+	authenticatorData, err := auth.DecodeWebAuthnData(loginReq.Response.AuthenticatorData)
+	if err != nil {
+		response.BadRequestResponse(ctx, "authenticatorData is not valid base64url")
+		return
+	}
+	signature, err := auth.DecodeWebAuthnData(loginReq.Response.Signature)
+	if err != nil {
+		response.BadRequestResponse(ctx, "signature is not valid base64url")
+		return
+	}
+	userHandle, err := auth.DecodeWebAuthnData(loginReq.Response.UserHandle)
+	if err != nil {
+		response.BadRequestResponse(ctx, "userHandle is not valid base64url")
+		return
+	}
+
+	challenge, err := controller.consumeWebAuthnChallenge(clientDataJSON, models.WebAuthnPurposeLogin, nil)
+	if err != nil {
+		controller.writeWebAuthnError(ctx, http.StatusUnauthorized, err)
+		return
+	}
+
+	var passkey models.Passkey
+	err = controller.db.Preload("User").Where("credential_id = ?", auth.EncodeWebAuthnData(credentialId)).Take(&passkey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			controller.recordLoginFailure(ctx, "", nil, "unknown_passkey")
+			response.UnauthorizedResponse(ctx, "Unknown passkey")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+	if passkey.User == nil {
+		response.UnauthorizedResponse(ctx, "Unknown passkey")
+		return
+	}
+	user := *passkey.User
+
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, auth.WebAuthnUserHandle(user.Id)) {
+		controller.recordLoginFailure(ctx, user.Email, &user.Id, "passkey_user_mismatch")
+		response.UnauthorizedResponse(ctx, "Passkey does not belong to this user")
+		return
+	}
+
+	assertion, err := controller.relyingParty.VerifyAssertion(challenge, clientDataJSON, authenticatorData, signature, passkey.PublicKey, passkey.SignCount)
+	if err != nil {
+		controller.recordLoginFailure(ctx, user.Email, &user.Id, "invalid_passkey_assertion")
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	// only move the counter forward from the value that was verified, so a concurrent login
+	// from a cloned authenticator can't slip in between
+	result := controller.db.Model(&models.Passkey{}).
+		Where("id = ? AND sign_count = ?", passkey.Id, passkey.SignCount).
+		Updates(map[string]interface{}{
+			"sign_count":   assertion.SignCount,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.UnauthorizedResponse(ctx, auth.ErrWebAuthnSignCount.Error())
+		return
+	}
+
+	// a passkey with user verification is already two factors; without it TOTP is still asked for
+	if user.TotpEnabledAt != nil && !assertion.UserVerified {
+		controller.writeMfaChallenge(ctx, user)
+		return
+	}
+
+	controller.startSession(ctx, user)
+}
+
+// FindAllPasskey godoc
+// @Summary List passkeys
+// @Description List the passkeys registered by the authenticated user
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} repository.PasskeyResponse
+// @Router /users/passkeys [get]
+func (controller *UserController) FindAllPasskey(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	var passkeys []models.Passkey
+
+	err = controller.db.Where("user_id = ?", principal.UserId).Order("id").Find(&passkeys).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	passkeyList := make([]repository.PasskeyResponse, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		passkeyList = append(passkeyList, passkeyResponse(passkey))
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, passkeyList)
+}
+
+// DeletePasskey godoc
+// @Summary Remove a passkey
+// @Description Remove a passkey from the authenticated user. It can no longer be used to log in.
+// @Tags users
+// @Produce json
+// @Param passkeyId path string true "Passkey ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/passkeys/{passkeyId} [delete]
+func (controller *UserController) DeletePasskey(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	passkeyId, err := strconv.ParseUint(ctx.Param("passkeyId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid passkey ID")
+		return
+	}
+
+	result := controller.db.Where("id = ? AND user_id = ?", passkeyId, principal.UserId).Delete(&models.Passkey{})
+	if result.Error != nil {
+		response.InternalServerJsonResponse(ctx, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.NotFoundResponse(ctx, "data not found")
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "The passkey has been successfully removed",
+	})
+}
+
+var errWebAuthnChallengeInvalid = errors.New("passkey challenge is invalid or has expired")
+
+// createWebAuthnChallenge stores a new challenge for a passkey ceremony and returns it base64url encoded.
+func (controller *UserController) createWebAuthnChallenge(purpose string, userId *uint) (string, error) {
+	err := controller.db.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnChallenge{}).Error
+	if err != nil {
+		return "", err
+	}
+
+	challenge, err := auth.GenerateWebAuthnChallenge()
+	if err != nil {
+		return "", err
+	}
+
+	err = controller.db.Create(&models.WebAuthnChallenge{
+		ChallengeHash: auth.HashToken(challenge),
+		Purpose:       purpose,
+		UserId:        userId,
+		ExpiresAt:     time.Now().Add(controller.relyingParty.Timeout),
+	}).Error
+	if err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge finds the challenge echoed in clientDataJSON and deletes it, so every challenge is single-use.
+func (controller *UserController) consumeWebAuthnChallenge(clientDataJSON []byte, purpose string, userId *uint) (string, error) {
+	clientData, err := auth.ParseClientData(clientDataJSON)
+	if err != nil {
+		return "", err
+	}
+
+	query := controller.db.Clauses(clause.Returning{}).
+		Where("challenge_hash = ? AND purpose = ? AND expires_at > ?", auth.HashToken(clientData.Challenge), purpose, time.Now())
+	if userId != nil {
+		query = query.Where("user_id = ?", *userId)
+	}
+
+	var challenge models.WebAuthnChallenge
+	result := query.Delete(&challenge)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errWebAuthnChallengeInvalid
+	}
+	return clientData.Challenge, nil
+}
+
+// writeWebAuthnError reports a rejected ceremony with status, and anything else as a server error.
+func (controller *UserController) writeWebAuthnError(ctx *gin.Context, status int, err error) {
+	if errors.Is(err, errWebAuthnChallengeInvalid) || errors.Is(err, auth.ErrWebAuthnClientData) {
+		response.WriteJsonResponse(ctx, status, gin.H{
+			"error":   true,
+			"message": err.Error(),
+		})
+		return
+	}
+	response.InternalServerJsonResponse(ctx, err.Error())
+}
+
+func (controller *UserController) userVerification() string {
+	if controller.relyingParty.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+func passkeyResponse(passkey models.Passkey) repository.PasskeyResponse {
+	return repository.PasskeyResponse{
+		Id:           passkey.Id,
+		Name:         passkey.Name,
+		CredentialId: passkey.CredentialId,
+		LastUsedAt:   passkey.LastUsedAt,
+		CreatedAt:    passkey.CreatedAt,
+	}
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+)
+
+// FindProfile godoc
+// @Summary Get a public profile
+// @Description Get the public profile of a user with photo, follower and following counts. Email and age are never included.
+// @Tags users
+// @Produce json
+// @Param username path string true "Username"
+// @Success 200 {object} repository.UserProfileResponse
+// @Router /users/{username} [get]
+func (controller *UserController) FindProfile(ctx *gin.Context) {
+	var user models.User
+
+	err := controller.db.Where("username = ?", ctx.Param("username")).Take(&user).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	profile, err := controller.profileResponse(user)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, profile)
+}
+
+// UpdateProfile godoc
+// @Summary Update your public profile
+// @Description Replace the display name, bio, website, avatar and pronouns of the authenticated user. Empty fields are cleared.
+// @Description is_private is only changed when sent; making the account public approves every pending follow request.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body repository.UserProfileRequest true "Profile"
+// @Success 200 {object} repository.UserProfileResponse
+// @Router /users/profile [put]
+func (controller *UserController) UpdateProfile(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	profileReq := repository.UserProfileRequest{}
+	var user models.User
+
+	err = ctx.ShouldBindJSON(&profileReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	_, err = govalidator.ValidateStruct(&profileReq)
+	if err != nil {
+		response.BadRequestResponse(ctx, err.Error())
+		return
+	}
+
+	fields := map[string][]string{}
+	if !isHttpUrl(profileReq.Website) {
+		fields["website"] = []string{"Website must be an http or https URL"}
+	}
+	if !isHttpUrl(profileReq.AvatarUrl) {
+		fields["avatar_url"] = []string{"Avatar url must be an http or https URL"}
+	}
+	if len(fields) > 0 {
+		response.ValidationErrorResponse(ctx, fields)
+		return
+	}
+
+	err = controller.db.First(&user, principal.UserId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "User data not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	// a map is used so empty values clear the field instead of being skipped
+	updates := map[string]interface{}{
+		"display_name": strings.TrimSpace(profileReq.DisplayName),
+		"bio":          strings.TrimSpace(profileReq.Bio),
+		"website":      profileReq.Website,
+		"avatar_url":   profileReq.AvatarUrl,
+		"pronouns":     strings.TrimSpace(profileReq.Pronouns),
+	}
+	madePublic := false
+	if profileReq.IsPrivate != nil {
+		madePublic = user.IsPrivate && !*profileReq.IsPrivate
+		updates["is_private"] = *profileReq.IsPrivate
+	}
+
+	err = controller.db.Model(&user).Updates(updates).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	if madePublic {
+		followerIds, err := approveFollowRequests(controller.db, user.Id)
+		if err != nil {
+			response.InternalServerJsonResponse(ctx, err.Error())
+			return
+		}
+		for _, followerId := range followerIds {
+			controller.timelines.Followed(followerId, user.Id)
+		}
+	}
+
+	profile, err := controller.profileResponse(user)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, profile)
+}
+
+func (controller *UserController) profileResponse(user models.User) (repository.UserProfileResponse, error) {
+	profile := repository.UserProfileResponse{
+		Id:          user.Id,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Website:     user.Website,
+		AvatarUrl:   user.AvatarUrl,
+		Pronouns:    user.Pronouns,
+		IsPrivate:   user.IsPrivate,
+		CreatedAt:   user.CreatedAt,
+	}
+
+	err := controller.db.Model(&models.Photo{}).Where("user_id = ?", user.Id).Count(&profile.PhotoCount).Error
+	if err != nil {
+		return profile, err
+	}
+	err = controller.db.Model(&models.Follow{}).Where("following_id = ?", user.Id).Count(&profile.FollowerCount).Error
+	if err != nil {
+		return profile, err
+	}
+	err = controller.db.Model(&models.Follow{}).Where("follower_id = ?", user.Id).Count(&profile.FollowingCount).Error
+	return profile, err
+}
+
+// isHttpUrl accepts an empty value or an absolute http(s) URL, which keeps javascript: and data: links out of profiles.
+func isHttpUrl(value string) bool {
+	if value == "" {
+		return true
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
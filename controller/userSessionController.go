@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
+	"gorm.io/gorm"
+)
+
+// FindAllSession godoc
+// @Summary List active sessions
+// @Description List the devices the authenticated user is logged in on
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} repository.UserSessionResponse
+// @Router /users/sessions [get]
+func (controller *UserController) FindAllSession(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	sessions, err := controller.sessions.List(principal.UserId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	sessionList := make([]repository.UserSessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		sessionList = append(sessionList, repository.UserSessionResponse{
+			Id:         session.Id,
+			UserAgent:  session.UserAgent,
+			Ip:         session.Ip,
+			Current:    session.FamilyId == principal.SessionId,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+		})
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, sessionList)
+}
+
+// DeleteSession godoc
+// @Summary Terminate a session
+// @Description Log out one of the authenticated user's sessions. Its access and refresh tokens stop working.
+// @Tags users
+// @Produce json
+// @Param sessionId path string true "Session ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} gin.H
+// @Router /users/sessions/{sessionId} [delete]
+func (controller *UserController) DeleteSession(ctx *gin.Context) {
+	principal, err := middleware.CurrentPrincipal(ctx)
+	if err != nil {
+		response.UnauthorizedResponse(ctx, err.Error())
+		return
+	}
+
+	sessionId, err := strconv.ParseUint(ctx.Param("sessionId"), 10, 64)
+	if err != nil {
+		response.BadRequestResponse(ctx, "Invalid session ID")
+		return
+	}
+
+	session, err := controller.sessions.Terminate(principal.UserId, uint(sessionId))
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "data not found")
+			return
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	err = controller.refreshTokens.RevokeFamily(session.FamilyId)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return
+	}
+
+	response.WriteJsonResponse(ctx, http.StatusOK, gin.H{
+		"error":   false,
+		"message": "The session has been successfully terminated",
+	})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/response"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+// canView reports whether principal may see the photos, comments and follow lists of owner.
+// Nobody sees the content of a user they blocked or were blocked by; otherwise the account has to
+// be public, their own or followed by them, unless they moderate content.
+func canView(db *gorm.DB, principal auth.Principal, owner models.User) (bool, error) {
+	if owner.Id == principal.UserId {
+		return true, nil
+	}
+
+	blocked, err := isBlocked(db, principal.UserId, owner.Id)
+	if err != nil || blocked {
+		return false, err
+	}
+	if !owner.IsPrivate || principal.HasRole(auth.RoleModerator, auth.RoleAdmin) {
+		return true, nil
+	}
+
+	var follows int64
+	err = db.Model(&models.Follow{}).
+		Where("follower_id = ? AND following_id = ?", principal.UserId, owner.Id).
+		Count(&follows).Error
+	return follows > 0, err
+}
+
+// isBlocked reports whether either user has blocked the other.
+func isBlocked(db *gorm.DB, userId, otherId uint) (bool, error) {
+	var blocks int64
+	err := db.Model(&models.Block{}).
+		Where("(blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)", userId, otherId, otherId, userId).
+		Count(&blocks).Error
+	return blocks > 0, err
+}
+
+// findVisiblePhoto loads a photo, writing a 404 when it doesn't exist or canView hides it from
+// principal, so hidden photos can't be told apart from missing ones.
+func findVisiblePhoto(ctx *gin.Context, db *gorm.DB, principal auth.Principal, photoId uint) (models.Photo, bool) {
+	var photo models.Photo
+	err := db.Take(&photo, photoId).Error
+	if err != nil {
+		if err.Error() == gorm.ErrRecordNotFound.Error() {
+			response.NotFoundResponse(ctx, "Photo not found")
+			return photo, false
+		}
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return photo, false
+	}
+
+	var owner models.User
+	err = db.Select("id", "is_private").Take(&owner, photo.UserId).Error
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return photo, false
+	}
+
+	visible, err := canView(db, principal, owner)
+	if err != nil {
+		response.InternalServerJsonResponse(ctx, err.Error())
+		return photo, false
+	}
+	if !visible {
+		response.NotFoundResponse(ctx, "Photo not found")
+		return photo, false
+	}
+	return photo, true
+}
+
+// visibleOwner is the privacy part of canView for a users table joined under the given name,
+// moderator and admin exception included, so lists show what opening the item by id would.
+// It expects the viewer id as the named argument @viewer.
+func visibleOwner(table string) string {
+	return fmt.Sprintf("(NOT %[1]s.is_private OR %[1]s.id = @viewer OR EXISTS "+
+		"(SELECT 1 FROM follows WHERE follows.follower_id = @viewer AND follows.following_id = %[1]s.id) OR EXISTS "+
+		"(SELECT 1 FROM users AS viewers WHERE viewers.id = @viewer AND viewers.role IN ('%[2]s', '%[3]s')))",
+		table, auth.RoleModerator, auth.RoleAdmin)
+}
+
+// notBlocked is the block part of canView for the user id in column. It expects the viewer id as
+// the named argument @viewer.
+func notBlocked(column string) string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = @viewer AND blocks.blocked_id = %[1]s) "+
+		"OR (blocks.blocker_id = %[1]s AND blocks.blocked_id = @viewer))", column)
+}
+
+// writeHidden answers a request for content canView refused. Blocked users are told the account
+// doesn't exist rather than that they were blocked.
+func writeHidden(ctx *gin.Context, owner models.User) {
+	if !owner.IsPrivate {
+		response.NotFoundResponse(ctx, "User not found")
+		return
+	}
+	response.WriteJsonResponse(ctx, http.StatusForbidden, gin.H{
+		"error":   true,
+		"code":    "account_private",
+		"message": "This account is private",
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/joho/godotenv"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -29,9 +32,68 @@ func ConnectDB() *gorm.DB {
 		log.Fatal(err)
 	}
 
-	if err := db.AutoMigrate(models.User{}, models.Social{}, models.Photo{}, models.Comment{}); err != nil {
+	// accounts created before email verification existed are grandfathered in below, so turning
+	// REQUIRE_VERIFIED_EMAIL on doesn't lock every existing user out of posting
+	backfillVerified := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt")
+
+	if err := db.AutoMigrate(models.User{}, models.Social{}, models.Photo{}, models.Comment{}, models.RefreshToken{}, models.RevokedToken{}, models.UserToken{}, models.RecoveryCode{}, models.LoginThrottle{}, models.LoginAttempt{}, models.ApiKey{}, models.Session{}, models.Identity{}, models.OidcState{}, models.Passkey{}, models.WebAuthnChallenge{}, models.Follow{}, models.Like{}, models.TimelineEntry{}, models.FollowRequest{}, models.Block{}, models.Mute{}, models.CommentReaction{}); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if err := createIndexes(db); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if backfillVerified {
+		if err := db.Exec("UPDATE users SET email_verified_at = COALESCE(created_at, NOW()) WHERE email_verified_at IS NULL").Error; err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+
+	if err := promoteAdmins(db, config.List("ADMIN_EMAILS", nil)); err != nil {
 		log.Fatal(err.Error())
 	}
 
 	return db
 }
+
+// promoteAdmins gives the admin role to the registered users with one of emails, which is how the
+// first admin is created; everyone after that can be promoted through PUT /users/:userId/role.
+// Addresses that aren't registered yet are promoted on the next startup after they sign up.
+func promoteAdmins(db *gorm.DB, emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+	for i := range emails {
+		emails[i] = strings.ToLower(emails[i])
+	}
+
+	var promoted []string
+	err := db.Raw("UPDATE users SET role = ? WHERE LOWER(email) IN ? AND role <> ? RETURNING email",
+		auth.RoleAdmin, emails, auth.RoleAdmin).Scan(&promoted).Error
+	if err != nil {
+		return err
+	}
+	for _, email := range promoted {
+		log.Printf("promoted %s to admin (ADMIN_EMAILS)", email)
+	}
+	return nil
+}
+
+// createIndexes adds the indexes struct tags can't describe, such as ones on the embedded
+// GormModel columns or with a sort order.
+func createIndexes(db *gorm.DB) error {
+	statements := []string{
+		// the feed walks each author's photos newest first
+		"CREATE INDEX IF NOT EXISTS idx_photos_user_created ON photos (user_id, created_at DESC, id DESC)",
+		// in fan-out mode only photos that were not copied to timelines are pulled
+		"CREATE INDEX IF NOT EXISTS idx_photos_pulled ON photos (user_id, created_at DESC, id DESC) WHERE NOT fanned_out",
+		"CREATE INDEX IF NOT EXISTS idx_timeline_entries_page ON timeline_entries (user_id, photo_created_at DESC, photo_id DESC)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ApiKey is a personal access key a user creates for scripts. Only the hash of the key is
+// stored; Prefix is kept so the user can tell keys apart.
+type ApiKey struct {
+	GormModel
+	UserId     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	KeyHash    string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"not null" json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	User       *User      `json:"user,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// Block records that BlockerId blocked BlockedId. While it exists neither user sees the other's
+// photos and comments, and they can't follow or comment on each other.
+type Block struct {
+	GormModel
+	BlockerId uint  `gorm:"not null;uniqueIndex:idx_block_pair" json:"blocker_id"`
+	BlockedId uint  `gorm:"not null;uniqueIndex:idx_block_pair;index" json:"blocked_id"`
+	Blocker   *User `json:"blocker,omitempty"`
+	Blocked   *User `json:"blocked,omitempty"`
+}
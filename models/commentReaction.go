@@ -0,0 +1,12 @@
+package models
+
+// CommentReaction is an emoji reaction of a user to a comment. A user has at most one reaction
+// per comment; reacting again replaces the emoji.
+type CommentReaction struct {
+	GormModel
+	CommentId uint     `gorm:"not null;uniqueIndex:idx_comment_reaction,priority:1" json:"comment_id"`
+	UserId    uint     `gorm:"not null;uniqueIndex:idx_comment_reaction,priority:2;index" json:"user_id"`
+	Emoji     string   `gorm:"not null;size:32" json:"emoji"`
+	Comment   *Comment `json:"comment,omitempty"`
+	User      *User    `json:"user,omitempty"`
+}
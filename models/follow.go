@@ -0,0 +1,11 @@
+package models
+
+// Follow records that FollowerId follows FollowingId. The unique pair index also serves lookups
+// by follower; following_id has its own index for follower lists.
+type Follow struct {
+	GormModel
+	FollowerId  uint  `gorm:"not null;uniqueIndex:idx_follow_pair" json:"follower_id"`
+	FollowingId uint  `gorm:"not null;uniqueIndex:idx_follow_pair;index" json:"following_id"`
+	Follower    *User `json:"follower,omitempty"`
+	Following   *User `json:"following,omitempty"`
+}
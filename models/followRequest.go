@@ -0,0 +1,11 @@
+package models
+
+// FollowRequest is a pending request from RequesterId to follow the private account TargetId.
+// Approving it replaces it with a Follow; rejecting or cancelling deletes it.
+type FollowRequest struct {
+	GormModel
+	RequesterId uint  `gorm:"not null;uniqueIndex:idx_follow_request_pair" json:"requester_id"`
+	TargetId    uint  `gorm:"not null;uniqueIndex:idx_follow_request_pair;index" json:"target_id"`
+	Requester   *User `json:"requester,omitempty"`
+	Target      *User `json:"target,omitempty"`
+}
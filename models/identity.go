@@ -0,0 +1,11 @@
+package models
+
+// Identity links an account at an external OpenID Connect provider to a user.
+type Identity struct {
+	GormModel
+	UserId   uint   `gorm:"not null;index" json:"user_id"`
+	Provider string `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject  string `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"subject"`
+	Email    string `json:"email"`
+	User     *User  `json:"user,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// Like records that a user liked a photo. A user can like a photo once.
+type Like struct {
+	GormModel
+	UserId  uint   `gorm:"not null;uniqueIndex:idx_like_photo_user,priority:2" json:"user_id"`
+	PhotoId uint   `gorm:"not null;uniqueIndex:idx_like_photo_user,priority:1" json:"photo_id"`
+	User    *User  `json:"user,omitempty"`
+	Photo   *Photo `json:"photo,omitempty"`
+}
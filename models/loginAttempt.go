@@ -0,0 +1,11 @@
+package models
+
+// LoginAttempt is the audit record of a failed login.
+type LoginAttempt struct {
+	GormModel
+	Email     string `gorm:"index" json:"email"`
+	UserId    *uint  `gorm:"index" json:"user_id,omitempty"`
+	Ip        string `gorm:"index" json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Reason    string `gorm:"not null" json:"reason"`
+}
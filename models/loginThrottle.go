@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for a key such as an account or an IP address.
+type LoginThrottle struct {
+	GormModel
+	Key           string    `gorm:"not null;uniqueIndex" json:"key"`
+	Failures      int       `gorm:"not null" json:"failures"`
+	LastFailureAt time.Time `gorm:"not null" json:"last_failure_at"`
+}
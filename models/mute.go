@@ -0,0 +1,11 @@
+package models
+
+// Mute records that MuterId no longer wants MutedId's photos in their feed. Unlike a block the
+// muted user notices nothing and follows are kept.
+type Mute struct {
+	GormModel
+	MuterId uint  `gorm:"not null;uniqueIndex:idx_mute_pair" json:"muter_id"`
+	MutedId uint  `gorm:"not null;uniqueIndex:idx_mute_pair;index" json:"muted_id"`
+	Muter   *User `json:"muter,omitempty"`
+	Muted   *User `json:"muted,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// OidcState holds what is needed to finish an authorization code flow once the provider
+// redirects back. LinkUserId is set when an existing user is linking a new identity.
+type OidcState struct {
+	GormModel
+	StateHash    string    `gorm:"not null;uniqueIndex" json:"-"`
+	CodeVerifier string    `gorm:"not null" json:"-"`
+	Nonce        string    `gorm:"not null" json:"-"`
+	LinkUserId   *uint     `json:"link_user_id,omitempty"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+}
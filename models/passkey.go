@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Passkey is a WebAuthn credential registered by a user. PublicKey holds the COSE encoded key
+// and SignCount the last counter the authenticator reported.
+type Passkey struct {
+	GormModel
+	UserId       uint       `gorm:"not null;index" json:"user_id"`
+	Name         string     `gorm:"not null" json:"name"`
+	CredentialId string     `gorm:"not null;uniqueIndex" json:"credential_id"`
+	PublicKey    []byte     `gorm:"not null" json:"-"`
+	Algorithm    int64      `gorm:"not null" json:"algorithm"`
+	SignCount    uint32     `gorm:"not null;default:0" json:"-"`
+	Aaguid       string     `json:"aaguid"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	User         *User      `json:"user,omitempty"`
+}
@@ -7,12 +7,16 @@ import (
 
 type Photo struct {
 	GormModel
-	Title    string    `gorm:"not null" json:"username"  valid:"required~Title is required"`
-	Caption  string    `gorm:"not null" json:"email"  valid:"required~Caption is required"`
-	PhotoUrl string    `gorm:"not null" json:"photo_url"  valid:"required~Photo url is required"`
-	UserId   uint      `gorm:"not null" json:"user_id"`
-	Comment  []Comment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"comments"`
-	User     *User     `json:"user"`
+	Title    string `gorm:"not null" json:"username"  valid:"required~Title is required"`
+	Caption  string `gorm:"not null" json:"email"  valid:"required~Caption is required"`
+	PhotoUrl string `gorm:"not null" json:"photo_url"  valid:"required~Photo url is required"`
+	UserId   uint   `gorm:"not null" json:"user_id"`
+	// LikeCount mirrors the number of likes rows and only changes in the same transaction as them
+	LikeCount int64 `gorm:"not null;default:0" json:"like_count"`
+	// FannedOut is set once the photo has been copied to its followers' timelines; until then the feed pulls it
+	FannedOut bool      `gorm:"not null;default:false" json:"-"`
+	Comment   []Comment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"comments"`
+	User      *User     `json:"user"`
 }
 
 func (photo *Photo) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RecoveryCode is a one-time code that can stand in for a TOTP code. Only its hash is stored.
+type RecoveryCode struct {
+	GormModel
+	UserId   uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+	User     *User      `json:"user,omitempty"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken is a server-side record of an issued refresh token. Tokens that are rotated
+// from the same login share a FamilyId so the whole chain can be revoked at once.
+type RefreshToken struct {
+	GormModel
+	UserId    uint       `gorm:"not null;index" json:"user_id"`
+	FamilyId  string     `gorm:"not null;index" json:"family_id"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	User      *User      `json:"user,omitempty"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// RevokedToken is an entry in the token denylist. A row either revokes a single access token
+// by its Jti, or (when Jti is empty) every token of UserId issued before RevokedBefore.
+type RevokedToken struct {
+	GormModel
+	Jti           string     `gorm:"index" json:"jti,omitempty"`
+	UserId        uint       `gorm:"not null;index" json:"user_id"`
+	RevokedBefore *time.Time `json:"revoked_before,omitempty"`
+	ExpiresAt     time.Time  `gorm:"not null;index" json:"expires_at"`
+}
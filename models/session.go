@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is one login of a user on a device. FamilyId links it to its refresh tokens and is
+// carried as the "sid" claim of every access token minted for it.
+type Session struct {
+	GormModel
+	UserId       uint       `gorm:"not null;index" json:"user_id"`
+	FamilyId     string     `gorm:"not null;uniqueIndex" json:"-"`
+	UserAgent    string     `json:"user_agent"`
+	Ip           string     `json:"ip"`
+	LastSeenAt   time.Time  `gorm:"not null" json:"last_seen_at"`
+	TerminatedAt *time.Time `gorm:"index" json:"terminated_at,omitempty"`
+	User         *User      `json:"user,omitempty"`
+}
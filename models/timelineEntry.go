@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// TimelineEntry places a photo on the home feed of UserId. Entries are only written when the
+// feed runs in fan-out mode; PhotoCreatedAt copies the photo's created_at so a timeline can be
+// paged without joining photos.
+type TimelineEntry struct {
+	GormModel
+	UserId         uint      `gorm:"not null;uniqueIndex:idx_timeline_user_photo" json:"user_id"`
+	PhotoId        uint      `gorm:"not null;uniqueIndex:idx_timeline_user_photo;index" json:"photo_id"`
+	AuthorId       uint      `gorm:"not null;index" json:"author_id"`
+	PhotoCreatedAt time.Time `gorm:"not null" json:"photo_created_at"`
+}
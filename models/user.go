@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"github.com/asaskevich/govalidator"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
 	"gorm.io/gorm"
@@ -8,13 +10,26 @@ import (
 
 type User struct {
 	GormModel
-	Username string    `gorm:"not null;uniqueIndex" json:"username,omitempty" form:"username" valid:"required~Your username is required"`
-	Email    string    `gorm:"not null;uniqueIndex" json:"email,omitempty" form:"email" valid:"required~Your email is required, email~Invalid email format,email~Invalid format email"`
-	Password string    `gorm:"not null" json:"password,omitempty" form:"password" valid:"required~Your password is required,minstringlength(6)~Password has to have a minimum length of 6 characters"`
-	Age      int       `gorm:"not null" json:"age,omitempty" form:"age" valid:"required~Your age is required,numeric~Fill age with number,range(8|99)~minimum 8 years old"`
-	Photos   []Photo   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"photos,omitempty"`
-	Comments []Comment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"comments,omitempty"`
-	Socials  []Social  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"socials,omitempty"`
+	Username    string `gorm:"not null;uniqueIndex" json:"username,omitempty" form:"username" valid:"required~Your username is required"`
+	Email       string `gorm:"not null;uniqueIndex" json:"email,omitempty" form:"email" valid:"required~Your email is required, email~Invalid email format,email~Invalid format email"`
+	Password    string `gorm:"not null" json:"password,omitempty" form:"password" valid:"required~Your password is required"`
+	Age         int    `gorm:"not null" json:"age,omitempty" form:"age" valid:"required~Your age is required,numeric~Fill age with number,range(8|99)~minimum 8 years old"`
+	Role        string `gorm:"not null;default:user" json:"role,omitempty"`
+	DisplayName string `gorm:"size:50" json:"display_name,omitempty"`
+	Bio         string `gorm:"size:160" json:"bio,omitempty"`
+	Website     string `gorm:"size:200" json:"website,omitempty"`
+	AvatarUrl   string `gorm:"size:500" json:"avatar_url,omitempty"`
+	Pronouns    string `gorm:"size:30" json:"pronouns,omitempty"`
+	// IsPrivate hides the user's photos, comments and follow lists from everyone but approved followers
+	IsPrivate         bool       `gorm:"not null;default:false" json:"is_private"`
+	EmailVerifiedAt   *time.Time `json:"email_verified_at,omitempty"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"`
+	TotpSecret        string     `json:"-"`
+	TotpEnabledAt     *time.Time `json:"totp_enabled_at,omitempty"`
+	TotpLastStep      int64      `json:"-"`
+	Photos            []Photo    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"photos,omitempty"`
+	Comments          []Comment  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"comments,omitempty"`
+	Socials           []Social   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"socials,omitempty"`
 }
 
 func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
@@ -31,3 +46,11 @@ func (user *User) BeforeCreate(tx *gorm.DB) (err error) {
 	user.Password = hash
 	return
 }
+
+// Roles returns the roles carried in the user's access tokens.
+func (user *User) Roles() []string {
+	if user.Role == "" {
+		return []string{auth.RoleUser}
+	}
+	return []string{user.Role}
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMagicLink         = "magic_link"
+)
+
+// UserToken is a single-use, expiring token mailed to a user, such as a password reset link.
+// Only the hash of the token is stored.
+type UserToken struct {
+	GormModel
+	UserId  uint   `gorm:"not null;index" json:"user_id"`
+	Purpose string `gorm:"not null;index" json:"purpose"`
+	// Email is the address the token was mailed to, for tokens that prove the user controls it
+	Email     string     `json:"-"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	User      *User      `json:"user,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	WebAuthnPurposeRegistration = "registration"
+	WebAuthnPurposeLogin        = "login"
+)
+
+// WebAuthnChallenge is an outstanding passkey ceremony. UserId is set for registrations;
+// logins use discoverable credentials, so the user is only known once the assertion arrives.
+type WebAuthnChallenge struct {
+	GormModel
+	ChallengeHash string    `gorm:"not null;uniqueIndex" json:"-"`
+	Purpose       string    `gorm:"not null" json:"purpose"`
+	UserId        *uint     `json:"user_id,omitempty"`
+	ExpiresAt     time.Time `gorm:"not null;index" json:"expires_at"`
+}
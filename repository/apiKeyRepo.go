@@ -0,0 +1,26 @@
+package repository
+
+import "time"
+
+// ApiKeyRequest represents the request body for creating an API key
+type ApiKeyRequest struct {
+	Name   string   `json:"name" valid:"required~Name is required" example:"backup script"`
+	Scopes []string `json:"scopes" example:"photos:read,photos:write"`
+}
+
+// ApiKeyResponse represents an API key without its secret
+type ApiKeyResponse struct {
+	Id         uint       `json:"id" example:"1"`
+	Name       string     `json:"name" example:"backup script"`
+	Prefix     string     `json:"prefix" example:"mgk_Ab12Cd"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  *time.Time `json:"created_at"`
+}
+
+// ApiKeyCreateResponse represents the response body for a new API key. Key is only returned once.
+type ApiKeyCreateResponse struct {
+	ApiKeyResponse
+	Key string `json:"key" example:"mgk_Ab12Cd..."`
+}
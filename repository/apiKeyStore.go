@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+const apiKeyPrefix = "mgk_"
+
+// lastUsedResolution limits how often last_used_at is written for a busy key.
+const lastUsedResolution = time.Minute
+
+var ErrApiKeyInvalid = errors.New("api key is invalid or has been revoked")
+
+// ApiKeyStore creates and authenticates personal API keys.
+type ApiKeyStore struct {
+	db *gorm.DB
+}
+
+func NewApiKeyStore(db *gorm.DB) *ApiKeyStore {
+	return &ApiKeyStore{
+		db: db,
+	}
+}
+
+// Create stores a new key and returns it together with the plain key, which is never shown again.
+func (store *ApiKeyStore) Create(userId uint, name string, scopes []string) (models.ApiKey, string, error) {
+	secret, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return models.ApiKey{}, "", err
+	}
+
+	key := apiKeyPrefix + secret
+	apiKey := models.ApiKey{
+		UserId:  userId,
+		Name:    name,
+		Prefix:  key[:len(apiKeyPrefix)+6],
+		KeyHash: auth.HashToken(key),
+		Scopes:  auth.JoinScopes(scopes),
+	}
+	if err := store.db.Create(&apiKey).Error; err != nil {
+		return models.ApiKey{}, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// Authenticate resolves a plain key to its record and owner, and records the use.
+func (store *ApiKeyStore) Authenticate(key string) (models.ApiKey, error) {
+	var apiKey models.ApiKey
+	err := store.db.Preload("User").
+		Where("key_hash = ? AND revoked_at IS NULL", auth.HashToken(key)).
+		Take(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apiKey, ErrApiKeyInvalid
+		}
+		return apiKey, err
+	}
+	if apiKey.User == nil {
+		return apiKey, ErrApiKeyInvalid
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= lastUsedResolution {
+		err = store.db.Model(&models.ApiKey{}).Where("id = ?", apiKey.Id).Update("last_used_at", now).Error
+		if err != nil {
+			return apiKey, err
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return apiKey, nil
+}
+
+// List returns the user's keys, newest first.
+func (store *ApiKeyStore) List(userId uint) ([]models.ApiKey, error) {
+	var apiKeys []models.ApiKey
+	err := store.db.Where("user_id = ?", userId).Order("id DESC").Find(&apiKeys).Error
+	return apiKeys, err
+}
+
+// Revoke disables one of the user's keys. It reports false when the user has no such active key.
+func (store *ApiKeyStore) Revoke(userId uint, keyId uint) (bool, error) {
+	result := store.db.Model(&models.ApiKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyId, userId).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokeUser disables every key of the user.
+func (store *ApiKeyStore) RevokeUser(userId uint) error {
+	return store.db.Model(&models.ApiKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
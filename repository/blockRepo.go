@@ -0,0 +1,9 @@
+package repository
+
+// Status blokir dan mute dari pengguna yang login terhadap pengguna lain
+// swagger:response relationResponse
+type RelationResponse struct {
+	Username string `json:"username"`
+	Blocked  bool   `json:"blocked"`
+	Muted    bool   `json:"muted"`
+}
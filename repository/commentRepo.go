@@ -10,12 +10,14 @@ type CommentRequest struct {
 
 // CommentCreateResponse represents the response body for creating a comment
 type CommentCreateResponse struct {
-	Id        uint       `json:"id"`
-	Message   string     `json:"message"`
-	PhotoId   uint       `json:"photo_id"`
-	UserId    uint       `json:"user_id,omitempty"`
-	CreatedAt *time.Time `json:"created_at,omitempty"`
-	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	Id          uint            `json:"id"`
+	Message     string          `json:"message"`
+	PhotoId     uint            `json:"photo_id"`
+	UserId      uint            `json:"user_id,omitempty"`
+	Reactions   []ReactionCount `json:"reactions"`
+	MyReactions []string        `json:"my_reactions"`
+	CreatedAt   *time.Time      `json:"created_at,omitempty"`
+	UpdatedAt   *time.Time      `json:"updated_at,omitempty"`
 }
 
 // CommentGetResponse represents the response body for getting multiple comments
@@ -54,3 +56,28 @@ type PhotoCommentResponse struct {
 type CommentUpdateRequest struct {
 	Message string `json:"message"`
 }
+
+// ReactionRequest represents the request body for reacting to a comment
+type ReactionRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// ReactionCount represents how many users reacted to a comment with one emoji
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int64  `json:"count"`
+}
+
+// CommentReactionsResponse represents the reactions on a comment after adding or removing one.
+// MyReactions lists the caller's own reactions, which is at most one emoji since reacting again
+// replaces it.
+type CommentReactionsResponse struct {
+	CommentId   uint            `json:"comment_id"`
+	Reactions   []ReactionCount `json:"reactions"`
+	MyReactions []string        `json:"my_reactions"`
+}
+
+// ReactionSetResponse represents the emojis comments can be reacted to with
+type ReactionSetResponse struct {
+	Emojis []string `json:"emojis"`
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "time"
+
+// Foto di feed beserta penulis dan jumlah like / komentar
+// swagger:model feedItem
+type FeedItem struct {
+	Id           uint              `json:"id"`
+	Title        string            `json:"title"`
+	Caption      string            `json:"caption"`
+	PhotoUrl     string            `json:"photo_url"`
+	User         UserPhotoResponse `json:"user"`
+	LikeCount    int64             `json:"like_count"`
+	CommentCount int64             `json:"comment_count"`
+	Liked        bool              `json:"liked"`
+	CreatedAt    *time.Time        `json:"created_at"`
+	UpdatedAt    *time.Time        `json:"updated_at"`
+}
+
+// swagger:response feedResponse
+type FeedResponse struct {
+	Items []FeedItem `json:"items"`
+	// NextCursor is passed as ?cursor= to get the next page; it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,50 @@
+package repository
+
+import "time"
+
+// swagger:response followResponse
+type FollowResponse struct {
+	Username   string `json:"username"`
+	Following  bool   `json:"following"`
+	FollowedBy bool   `json:"followed_by"`
+	Mutual     bool   `json:"mutual"`
+	// Requested is true while a request to follow a private account waits for approval
+	Requested bool `json:"requested"`
+}
+
+// Pengguna di daftar follower / following
+// swagger:model followUserData
+type FollowUserData struct {
+	Id          uint       `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	AvatarUrl   string     `json:"avatar_url"`
+	Mutual      bool       `json:"mutual"`
+	FollowedAt  *time.Time `json:"followed_at"`
+}
+
+// swagger:response followListResponse
+type FollowListResponse struct {
+	Users []FollowUserData `json:"users"`
+	Page  int              `json:"page"`
+	Limit int              `json:"limit"`
+	Total int64            `json:"total"`
+}
+
+// Permintaan follow yang menunggu persetujuan
+// swagger:model followRequestData
+type FollowRequestData struct {
+	Id          uint       `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	AvatarUrl   string     `json:"avatar_url"`
+	RequestedAt *time.Time `json:"requested_at"`
+}
+
+// swagger:response followRequestListResponse
+type FollowRequestListResponse struct {
+	Requests []FollowRequestData `json:"requests"`
+	Page     int                 `json:"page"`
+	Limit    int                 `json:"limit"`
+	Total    int64               `json:"total"`
+}
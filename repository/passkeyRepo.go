@@ -0,0 +1,94 @@
+package repository
+
+import "time"
+
+// PasskeyRelyingParty identifies this server to the authenticator
+type PasskeyRelyingParty struct {
+	Id   string `json:"id" example:"localhost"`
+	Name string `json:"name" example:"MyGRAM"`
+}
+
+// PasskeyUser is the account a new credential is created for. Id is the base64url user handle.
+type PasskeyUser struct {
+	Id          string `json:"id" example:"AAAAAAAAAAE"`
+	Name        string `json:"name" example:"johndoe@example.com"`
+	DisplayName string `json:"displayName" example:"johndoe"`
+}
+
+// PasskeyCredentialParam is one accepted public key algorithm
+type PasskeyCredentialParam struct {
+	Type string `json:"type" example:"public-key"`
+	Alg  int64  `json:"alg" example:"-7"`
+}
+
+// PasskeyCredentialDescriptor refers to an existing credential by its base64url id
+type PasskeyCredentialDescriptor struct {
+	Type string `json:"type" example:"public-key"`
+	Id   string `json:"id"`
+}
+
+// PasskeyAuthenticatorSelection states what kind of authenticator is wanted
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey" example:"required"`
+	UserVerification string `json:"userVerification" example:"preferred"`
+}
+
+// PasskeyRegisterOptionsResponse is passed as publicKey to navigator.credentials.create().
+// Binary fields are base64url encoded and must be decoded by the client.
+type PasskeyRegisterOptionsResponse struct {
+	Challenge              string                        `json:"challenge"`
+	Rp                     PasskeyRelyingParty           `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	PubKeyCredParams       []PasskeyCredentialParam      `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout" example:"300000"`
+	Attestation            string                        `json:"attestation" example:"none"`
+	ExcludeCredentials     []PasskeyCredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+}
+
+// PasskeyLoginOptionsResponse is passed as publicKey to navigator.credentials.get()
+type PasskeyLoginOptionsResponse struct {
+	Challenge        string                        `json:"challenge"`
+	RpId             string                        `json:"rpId" example:"localhost"`
+	Timeout          int64                         `json:"timeout" example:"300000"`
+	UserVerification string                        `json:"userVerification" example:"preferred"`
+	AllowCredentials []PasskeyCredentialDescriptor `json:"allowCredentials"`
+}
+
+// PasskeyAttestationResponse is the response member of the credential returned by navigator.credentials.create()
+type PasskeyAttestationResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" valid:"required~clientDataJSON is required"`
+	AttestationObject string `json:"attestationObject" valid:"required~attestationObject is required"`
+}
+
+// PasskeyRegisterRequest represents the request body for finishing passkey registration
+type PasskeyRegisterRequest struct {
+	Name     string                     `json:"name" valid:"required~Name is required" example:"MacBook Touch ID"`
+	Id       string                     `json:"id" valid:"required~Credential id is required"`
+	Type     string                     `json:"type" example:"public-key"`
+	Response PasskeyAttestationResponse `json:"response"`
+}
+
+// PasskeyAssertionResponse is the response member of the credential returned by navigator.credentials.get()
+type PasskeyAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON" valid:"required~clientDataJSON is required"`
+	AuthenticatorData string `json:"authenticatorData" valid:"required~authenticatorData is required"`
+	Signature         string `json:"signature" valid:"required~signature is required"`
+	UserHandle        string `json:"userHandle"`
+}
+
+// PasskeyLoginRequest represents the request body for logging in with a passkey
+type PasskeyLoginRequest struct {
+	Id       string                   `json:"id" valid:"required~Credential id is required"`
+	Type     string                   `json:"type" example:"public-key"`
+	Response PasskeyAssertionResponse `json:"response"`
+}
+
+// PasskeyResponse represents a registered passkey
+type PasskeyResponse struct {
+	Id           uint       `json:"id" example:"1"`
+	Name         string     `json:"name" example:"MacBook Touch ID"`
+	CredentialId string     `json:"credential_id"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
@@ -16,6 +16,7 @@ type PhotoCreateResponse struct {
 	Caption   string     `json:"caption"`
 	PhotoUrl  string     `json:"photo_url"`
 	UserId    uint       `json:"user_id,omitempty"`
+	LikeCount int64      `json:"like_count"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty"`
 }
@@ -33,6 +34,7 @@ type PhotoData struct {
 	Caption   string            `json:"caption"`
 	PhotoUrl  string            `json:"photo_url"`
 	User      UserPhotoResponse `json:"user"`
+	LikeCount int64             `json:"like_count"`
 	CreatedAt *time.Time        `json:"created_at"`
 	UpdatedAt *time.Time        `json:"updated_at"`
 }
@@ -40,6 +42,35 @@ type PhotoData struct {
 // Data user pada foto
 // swagger:model userPhotoResponse
 type UserPhotoResponse struct {
-	Email    string `json:"email"`
-	Username string `json:"username"`
+	Id          uint   `json:"id,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarUrl   string `json:"avatar_url,omitempty"`
+}
+
+// Status like foto dari pengguna yang login
+// swagger:response likeResponse
+type LikeResponse struct {
+	PhotoId   uint  `json:"photo_id"`
+	Liked     bool  `json:"liked"`
+	LikeCount int64 `json:"like_count"`
+}
+
+// Pengguna yang menyukai foto
+// swagger:model likeUserData
+type LikeUserData struct {
+	Id          uint       `json:"id"`
+	Username    string     `json:"username"`
+	DisplayName string     `json:"display_name"`
+	AvatarUrl   string     `json:"avatar_url"`
+	LikedAt     *time.Time `json:"liked_at"`
+}
+
+// swagger:response likeListResponse
+type LikeListResponse struct {
+	Users []LikeUserData `json:"users"`
+	Page  int            `json:"page"`
+	Limit int            `json:"limit"`
+	Total int64          `json:"total"`
 }
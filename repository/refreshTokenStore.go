@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token is expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// RefreshTokenStore keeps refresh tokens server-side (hashed) and rotates them on every use.
+type RefreshTokenStore struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenStore(db *gorm.DB) *RefreshTokenStore {
+	return &RefreshTokenStore{
+		db: db,
+	}
+}
+
+// Issue starts a new token family for the user and returns the plain refresh token and the family id.
+func (store *RefreshTokenStore) Issue(userId uint) (string, string, error) {
+	familyId, err := auth.GenerateOpaqueToken(16)
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := store.issue(store.db, userId, familyId)
+	if err != nil {
+		return "", "", err
+	}
+	return token, familyId, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same family. Presenting a token that
+// was already rotated is treated as theft and revokes every token in its family.
+// The returned record is the token that was exchanged.
+func (store *RefreshTokenStore) Rotate(token string) (string, models.RefreshToken, error) {
+	var refreshToken models.RefreshToken
+	err := store.db.Where("token_hash = ?", auth.HashToken(token)).Take(&refreshToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", models.RefreshToken{}, ErrRefreshTokenInvalid
+		}
+		return "", models.RefreshToken{}, err
+	}
+
+	if refreshToken.RotatedAt != nil {
+		if err := store.RevokeFamily(refreshToken.FamilyId); err != nil {
+			return "", models.RefreshToken{}, err
+		}
+		return "", models.RefreshToken{}, ErrRefreshTokenReused
+	}
+	if refreshToken.RevokedAt != nil {
+		return "", models.RefreshToken{}, ErrRefreshTokenInvalid
+	}
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return "", models.RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	var newToken string
+	err = store.db.Transaction(func(tx *gorm.DB) error {
+		// the guard on rotated_at makes two concurrent refreshes with the same token race safely
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", refreshToken.Id).
+			Update("rotated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		newToken, err = store.issue(tx, refreshToken.UserId, refreshToken.FamilyId)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if err := store.RevokeFamily(refreshToken.FamilyId); err != nil {
+			return "", models.RefreshToken{}, err
+		}
+		return "", models.RefreshToken{}, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return newToken, refreshToken, nil
+}
+
+// RevokeFamily revokes every refresh token descending from the same login.
+func (store *RefreshTokenStore) RevokeFamily(familyId string) error {
+	return store.db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyId).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUser revokes every refresh token that belongs to the user.
+func (store *RefreshTokenStore) RevokeUser(userId uint) error {
+	return store.db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (store *RefreshTokenStore) issue(db *gorm.DB, userId uint, familyId string) (string, error) {
+	token, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	refreshToken := models.RefreshToken{
+		UserId:    userId,
+		FamilyId:  familyId,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL()),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+type revocationEntry struct {
+	revoked   bool
+	cutoff    time.Time
+	expiresAt time.Time
+	checkedAt time.Time
+}
+
+// RevocationStore is the access token denylist. Revocations are persisted in Postgres and
+// cached in memory; a negative lookup is cached for REVOCATION_CACHE_TTL so other instances
+// pick up a revocation within that window.
+type RevocationStore struct {
+	db     *gorm.DB
+	ttl    time.Duration
+	mu     sync.RWMutex
+	tokens map[string]revocationEntry
+	users  map[uint]revocationEntry
+}
+
+func NewRevocationStore(db *gorm.DB) *RevocationStore {
+	return &RevocationStore{
+		db:     db,
+		ttl:    config.Duration("REVOCATION_CACHE_TTL", 30*time.Second),
+		tokens: map[string]revocationEntry{},
+		users:  map[uint]revocationEntry{},
+	}
+}
+
+// RevokeToken denylists a single access token until it expires.
+func (store *RevocationStore) RevokeToken(jti string, userId uint, expiresAt time.Time) error {
+	err := store.db.Create(&models.RevokedToken{
+		Jti:       jti,
+		UserId:    userId,
+		ExpiresAt: expiresAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	store.tokens[jti] = revocationEntry{revoked: true, expiresAt: expiresAt, checkedAt: time.Now()}
+	store.mu.Unlock()
+	return nil
+}
+
+// RevokeUser denylists every access token of the user issued before the current second.
+// "iat" only has second precision, so tokens minted within the same second survive; this is
+// what lets a caller receive a fresh token right after revoking everything else.
+func (store *RevocationStore) RevokeUser(userId uint) error {
+	cutoff := time.Now().Truncate(time.Second)
+	err := store.db.Create(&models.RevokedToken{
+		UserId:        userId,
+		RevokedBefore: &cutoff,
+		ExpiresAt:     cutoff.Add(auth.AccessTokenTTL()),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	store.mu.Lock()
+	store.users[userId] = revocationEntry{revoked: true, cutoff: cutoff, checkedAt: time.Now()}
+	store.mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether the token identified by jti, issued to userId at issuedAt, has been revoked.
+func (store *RevocationStore) IsRevoked(jti string, userId uint, issuedAt time.Time) (bool, error) {
+	revoked, err := store.isTokenRevoked(jti)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	cutoff, err := store.userCutoff(userId)
+	if err != nil {
+		return false, err
+	}
+	return !cutoff.IsZero() && issuedAt.Before(cutoff), nil
+}
+
+// PurgeExpired removes denylist rows and cache entries for tokens that could no longer be used anyway.
+func (store *RevocationStore) PurgeExpired() error {
+	now := time.Now()
+
+	store.mu.Lock()
+	for jti, entry := range store.tokens {
+		if (entry.revoked && now.After(entry.expiresAt)) || (!entry.revoked && now.Sub(entry.checkedAt) >= store.ttl) {
+			delete(store.tokens, jti)
+		}
+	}
+	for userId, entry := range store.users {
+		if now.Sub(entry.checkedAt) >= store.ttl {
+			delete(store.users, userId)
+		}
+	}
+	store.mu.Unlock()
+
+	return store.db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error
+}
+
+// StartPurging runs PurgeExpired every interval in the background.
+func (store *RevocationStore) StartPurging(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := store.PurgeExpired(); err != nil {
+				log.Println("purge revoked tokens:", err)
+			}
+		}
+	}()
+}
+
+func (store *RevocationStore) isTokenRevoked(jti string) (bool, error) {
+	store.mu.RLock()
+	entry, ok := store.tokens[jti]
+	store.mu.RUnlock()
+	if ok && (entry.revoked || time.Since(entry.checkedAt) < store.ttl) {
+		return entry.revoked, nil
+	}
+
+	var revokedToken models.RevokedToken
+	result := store.db.Where("jti = ?", jti).Limit(1).Find(&revokedToken)
+	if result.Error != nil {
+		return false, result.Error
+	}
+
+	revoked := result.RowsAffected > 0
+	store.mu.Lock()
+	store.tokens[jti] = revocationEntry{revoked: revoked, expiresAt: revokedToken.ExpiresAt, checkedAt: time.Now()}
+	store.mu.Unlock()
+	return revoked, nil
+}
+
+func (store *RevocationStore) userCutoff(userId uint) (time.Time, error) {
+	store.mu.RLock()
+	entry, ok := store.users[userId]
+	store.mu.RUnlock()
+	if ok && time.Since(entry.checkedAt) < store.ttl {
+		return entry.cutoff, nil
+	}
+
+	var revokedToken models.RevokedToken
+	result := store.db.Where("user_id = ? AND jti = '' AND revoked_before IS NOT NULL", userId).
+		Order("revoked_before DESC").Limit(1).Find(&revokedToken)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+
+	var cutoff time.Time
+	if result.RowsAffected > 0 {
+		cutoff = *revokedToken.RevokedBefore
+	}
+
+	store.mu.Lock()
+	store.users[userId] = revocationEntry{revoked: !cutoff.IsZero(), cutoff: cutoff, checkedAt: time.Now()}
+	store.mu.Unlock()
+	return cutoff, nil
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+type sessionEntry struct {
+	active    bool
+	checkedAt time.Time
+	touchedAt time.Time
+}
+
+// SessionStore records logins per device. Whether a session is still active is cached for
+// SESSION_CACHE_TTL, and last_seen_at is written at most once per SESSION_TOUCH_INTERVAL.
+type SessionStore struct {
+	db            *gorm.DB
+	ttl           time.Duration
+	touchInterval time.Duration
+	mu            sync.Mutex
+	entries       map[string]sessionEntry
+}
+
+func NewSessionStore(db *gorm.DB) *SessionStore {
+	return &SessionStore{
+		db:            db,
+		ttl:           config.Duration("SESSION_CACHE_TTL", 30*time.Second),
+		touchInterval: config.Duration("SESSION_TOUCH_INTERVAL", time.Minute),
+		entries:       map[string]sessionEntry{},
+	}
+}
+
+// Create records a new session for the refresh token family familyId.
+func (store *SessionStore) Create(userId uint, familyId, userAgent, ip string) (models.Session, error) {
+	now := time.Now()
+	session := models.Session{
+		UserId:     userId,
+		FamilyId:   familyId,
+		UserAgent:  userAgent,
+		Ip:         ip,
+		LastSeenAt: now,
+	}
+	if err := store.db.Create(&session).Error; err != nil {
+		return session, err
+	}
+
+	store.mu.Lock()
+	store.entries[familyId] = sessionEntry{active: true, checkedAt: now, touchedAt: now}
+	store.mu.Unlock()
+	return session, nil
+}
+
+// Active reports whether the session exists and has not been terminated. An empty familyId
+// means the credential is not bound to a session, so there is nothing to check.
+func (store *SessionStore) Active(familyId string) (bool, error) {
+	if familyId == "" {
+		return true, nil
+	}
+
+	store.mu.Lock()
+	entry, ok := store.entries[familyId]
+	store.mu.Unlock()
+	if ok && (!entry.active || time.Since(entry.checkedAt) < store.ttl) {
+		return entry.active, nil
+	}
+
+	var session models.Session
+	err := store.db.Select("id", "terminated_at").Where("family_id = ?", familyId).Take(&session).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	active := err == nil && session.TerminatedAt == nil
+
+	store.mu.Lock()
+	entry = store.entries[familyId]
+	entry.active = active
+	entry.checkedAt = time.Now()
+	store.entries[familyId] = entry
+	store.mu.Unlock()
+	return active, nil
+}
+
+// Touch updates last_seen_at (and the client IP) unless it was written recently.
+func (store *SessionStore) Touch(familyId, ip string) error {
+	if familyId == "" {
+		return nil
+	}
+
+	now := time.Now()
+	store.mu.Lock()
+	entry, ok := store.entries[familyId]
+	if ok && now.Sub(entry.touchedAt) < store.touchInterval {
+		store.mu.Unlock()
+		return nil
+	}
+	entry.touchedAt = now
+	store.entries[familyId] = entry
+	store.mu.Unlock()
+
+	return store.db.Model(&models.Session{}).
+		Where("family_id = ? AND terminated_at IS NULL", familyId).
+		Updates(map[string]interface{}{"last_seen_at": now, "ip": ip}).Error
+}
+
+// List returns the user's active sessions, most recently used first.
+func (store *SessionStore) List(userId uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := store.db.Where("user_id = ? AND terminated_at IS NULL", userId).Order("last_seen_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Terminate ends one of the user's sessions and returns it. It reports gorm.ErrRecordNotFound
+// when the user has no such active session.
+func (store *SessionStore) Terminate(userId uint, sessionId uint) (models.Session, error) {
+	var session models.Session
+	err := store.db.Where("id = ? AND user_id = ? AND terminated_at IS NULL", sessionId, userId).Take(&session).Error
+	if err != nil {
+		return session, err
+	}
+
+	return session, store.TerminateFamily(session.FamilyId)
+}
+
+// TerminateFamily ends the session that owns the refresh token family.
+func (store *SessionStore) TerminateFamily(familyId string) error {
+	err := store.db.Model(&models.Session{}).
+		Where("family_id = ? AND terminated_at IS NULL", familyId).
+		Update("terminated_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	store.forget(familyId)
+	return nil
+}
+
+// TerminateUser ends every session of the user.
+func (store *SessionStore) TerminateUser(userId uint) error {
+	var familyIds []string
+	err := store.db.Model(&models.Session{}).
+		Where("user_id = ? AND terminated_at IS NULL", userId).
+		Pluck("family_id", &familyIds).Error
+	if err != nil {
+		return err
+	}
+
+	err = store.db.Model(&models.Session{}).
+		Where("user_id = ? AND terminated_at IS NULL", userId).
+		Update("terminated_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	for _, familyId := range familyIds {
+		store.forget(familyId)
+	}
+	return nil
+}
+
+// PurgeCache drops cache entries that would be reloaded on next use anyway.
+func (store *SessionStore) PurgeCache() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for familyId, entry := range store.entries {
+		if time.Since(entry.checkedAt) >= store.ttl && time.Since(entry.touchedAt) >= store.touchInterval {
+			delete(store.entries, familyId)
+		}
+	}
+}
+
+// StartPurging runs PurgeCache every interval in the background.
+func (store *SessionStore) StartPurging(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			store.PurgeCache()
+		}
+	}()
+}
+
+func (store *SessionStore) forget(familyId string) {
+	store.mu.Lock()
+	store.entries[familyId] = sessionEntry{active: false, checkedAt: time.Now()}
+	store.mu.Unlock()
+}
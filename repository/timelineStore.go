@@ -0,0 +1,252 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+// Feed modes, selected with FEED_MODE
+const (
+	FeedModePull   = "pull"
+	FeedModeFanOut = "fanout"
+	FeedModeHybrid = "hybrid"
+)
+
+// timelineJob is either a new photo to fan out or a new follow to backfill.
+type timelineJob struct {
+	photoId     uint
+	followerId  uint
+	followingId uint
+}
+
+// TimelineStore materializes home feeds. In fan-out mode background workers copy every new photo
+// to the timeline of each follower of its author; in hybrid mode authors with at least
+// FEED_CELEBRITY_THRESHOLD followers are skipped and their photos are pulled when the feed is read.
+// A photo that is not fanned out, because its job is still queued, was dropped or failed, is
+// pulled as well, so a slow or full queue makes the feed slower to read but never incomplete.
+type TimelineStore struct {
+	db                 *gorm.DB
+	mode               string
+	celebrityThreshold int
+	batchSize          int
+	followBackfill     int
+	jobs               chan timelineJob
+}
+
+func NewTimelineStore(db *gorm.DB) *TimelineStore {
+	mode := config.Get("FEED_MODE", FeedModePull)
+	switch mode {
+	case FeedModePull, FeedModeFanOut, FeedModeHybrid:
+	default:
+		log.Printf("unknown FEED_MODE %q, using pull", mode)
+		mode = FeedModePull
+	}
+
+	return &TimelineStore{
+		db:                 db,
+		mode:               mode,
+		celebrityThreshold: config.Int("FEED_CELEBRITY_THRESHOLD", 10000),
+		batchSize:          config.Int("FEED_FANOUT_BATCH", 1000),
+		followBackfill:     config.Int("FEED_FOLLOW_BACKFILL", 50),
+		jobs:               make(chan timelineJob, config.Int("FEED_FANOUT_QUEUE", 1024)),
+	}
+}
+
+// Enabled reports whether timelines are materialized; when false the feed is pulled entirely.
+func (store *TimelineStore) Enabled() bool {
+	return store.mode != FeedModePull
+}
+
+// StartWorkers processes queued jobs with the given number of goroutines. It does nothing in pull mode.
+func (store *TimelineStore) StartWorkers(workers int) {
+	if !store.Enabled() {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range store.jobs {
+				var err error
+				if job.photoId != 0 {
+					err = store.FanOut(job.photoId)
+				} else {
+					err = store.BackfillFollow(job.followerId, job.followingId)
+				}
+				if err != nil {
+					log.Println("timeline fan-out:", err)
+				}
+			}
+		}()
+	}
+}
+
+// Publish queues a new photo for fan-out.
+func (store *TimelineStore) Publish(photoId uint) {
+	store.enqueue(timelineJob{photoId: photoId})
+}
+
+// Followed queues copying the recent photos of followingId to the timeline of followerId.
+func (store *TimelineStore) Followed(followerId, followingId uint) {
+	store.enqueue(timelineJob{followerId: followerId, followingId: followingId})
+}
+
+// enqueue never blocks a request: when the queue is full the job is dropped and the photos
+// involved are pulled until timeline-backfill runs.
+func (store *TimelineStore) enqueue(job timelineJob) {
+	if !store.Enabled() {
+		return
+	}
+
+	select {
+	case store.jobs <- job:
+	default:
+		log.Printf("timeline queue is full, dropping %+v", job)
+	}
+}
+
+// Unfollowed removes the photos of followingId from the timeline of followerId.
+func (store *TimelineStore) Unfollowed(followerId, followingId uint) error {
+	return store.db.Where("user_id = ? AND author_id = ?", followerId, followingId).Delete(&models.TimelineEntry{}).Error
+}
+
+// RemovePhoto removes a photo from every timeline. It runs on db so it can be part of the
+// transaction that deletes the photo.
+func (store *TimelineStore) RemovePhoto(db *gorm.DB, photoId uint) error {
+	return db.Where("photo_id = ?", photoId).Delete(&models.TimelineEntry{}).Error
+}
+
+// IsCelebrity reports whether the photos of authorId are pulled instead of fanned out. Counting
+// stops at the threshold so large accounts cost no more than the threshold to check.
+func (store *TimelineStore) IsCelebrity(authorId uint) (bool, error) {
+	if store.mode != FeedModeHybrid {
+		return false, nil
+	}
+
+	var followers int64
+	err := store.db.Raw("SELECT COUNT(*) FROM (SELECT 1 FROM follows WHERE following_id = ? LIMIT ?) capped",
+		authorId, store.celebrityThreshold).Scan(&followers).Error
+	return followers >= int64(store.celebrityThreshold), err
+}
+
+// FanOut copies a photo to the timelines of its author's followers in batches of FEED_FANOUT_BATCH
+// and then marks it fanned out. Photos of celebrities are left to be pulled.
+func (store *TimelineStore) FanOut(photoId uint) error {
+	var photo models.Photo
+	err := store.db.Select("id", "user_id", "fanned_out").Take(&photo, photoId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// deleted before its turn came
+		return nil
+	}
+	if err != nil || photo.FannedOut {
+		return err
+	}
+
+	celebrity, err := store.IsCelebrity(photo.UserId)
+	if err != nil || celebrity {
+		return err
+	}
+
+	var after uint
+	for {
+		var followers []uint
+		err := store.db.Model(&models.Follow{}).
+			Where("following_id = ? AND follower_id > ?", photo.UserId, after).
+			Order("follower_id").
+			Limit(store.batchSize).
+			Pluck("follower_id", &followers).Error
+		if err != nil {
+			return err
+		}
+		if len(followers) == 0 {
+			break
+		}
+
+		// joining photos copies the stored created_at and inserts nothing once the photo is deleted
+		err = store.db.Exec(`INSERT INTO timeline_entries (created_at, updated_at, user_id, photo_id, author_id, photo_created_at)
+			SELECT NOW(), NOW(), follows.follower_id, photos.id, photos.user_id, photos.created_at
+			FROM follows JOIN photos ON photos.user_id = follows.following_id
+			WHERE photos.id = ? AND follows.follower_id IN ?
+			ON CONFLICT DO NOTHING`, photo.Id, followers).Error
+		if err != nil {
+			return err
+		}
+
+		after = followers[len(followers)-1]
+		if len(followers) < store.batchSize {
+			break
+		}
+	}
+
+	// UpdateColumn leaves updated_at alone, it is the photo's edit time
+	return store.db.Model(&models.Photo{}).Where("id = ?", photo.Id).UpdateColumn("fanned_out", true).Error
+}
+
+// BackfillFollow copies the FEED_FOLLOW_BACKFILL newest photos of followingId to the timeline of
+// followerId, provided the follow still exists. Photos still waiting for fan-out are copied too
+// so a follow racing with a new photo does not lose it.
+func (store *TimelineStore) BackfillFollow(followerId, followingId uint) error {
+	celebrity, err := store.IsCelebrity(followingId)
+	if err != nil || celebrity {
+		return err
+	}
+
+	return store.db.Exec(`INSERT INTO timeline_entries (created_at, updated_at, user_id, photo_id, author_id, photo_created_at)
+		SELECT NOW(), NOW(), ?, photos.id, photos.user_id, photos.created_at
+		FROM photos
+		WHERE photos.user_id = ?
+			AND EXISTS (SELECT 1 FROM follows WHERE follower_id = ? AND following_id = ?)
+		ORDER BY photos.created_at DESC, photos.id DESC
+		LIMIT ?
+		ON CONFLICT DO NOTHING`, followerId, followingId, followerId, followingId, store.followBackfill).Error
+}
+
+// FanOutPending fans out every photo created since that is not fanned out yet, oldest first,
+// and returns how many it went through.
+func (store *TimelineStore) FanOutPending(since time.Time) (int, error) {
+	processed := 0
+	var after uint
+	for {
+		var photoIds []uint
+		err := store.db.Model(&models.Photo{}).
+			Where("NOT fanned_out AND created_at >= ? AND id > ?", since, after).
+			Order("id").
+			Limit(store.batchSize).
+			Pluck("id", &photoIds).Error
+		if err != nil {
+			return processed, err
+		}
+		if len(photoIds) == 0 {
+			return processed, nil
+		}
+
+		for _, photoId := range photoIds {
+			if err := store.FanOut(photoId); err != nil {
+				return processed, err
+			}
+			processed++
+		}
+		after = photoIds[len(photoIds)-1]
+	}
+}
+
+// Rebuild replaces the timeline of userId with the fanned out photos created since by the
+// accounts they follow.
+func (store *TimelineStore) Rebuild(userId uint, since time.Time) error {
+	return store.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userId).Delete(&models.TimelineEntry{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`INSERT INTO timeline_entries (created_at, updated_at, user_id, photo_id, author_id, photo_created_at)
+			SELECT NOW(), NOW(), follows.follower_id, photos.id, photos.user_id, photos.created_at
+			FROM follows JOIN photos ON photos.user_id = follows.following_id
+			WHERE follows.follower_id = ? AND photos.fanned_out AND photos.created_at >= ?
+			ON CONFLICT DO NOTHING`, userId, since).Error
+	})
+}
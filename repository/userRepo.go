@@ -1,6 +1,39 @@
 package repository
 
-import "time"
+import (
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// reservedUsernames are the static segments under /users; a user named after one of them would
+// have a profile that GET /users/:username can't reach
+var reservedUsernames = map[string]bool{
+	"login": true, "register": true, "refresh": true, "magic-link": true, "logout": true,
+	"logout-all": true, "password": true, "email": true, "2fa": true, "profile": true,
+	"sessions": true, "identities": true, "passkeys": true, "api-keys": true, "follow-requests": true,
+}
+
+func init() {
+	govalidator.TagMap["unreserved"] = govalidator.Validator(func(str string) bool {
+		return !IsReservedUsername(str)
+	})
+}
+
+// IsReservedUsername reports whether username is taken by a /users route.
+func IsReservedUsername(username string) bool {
+	return reservedUsernames[strings.ToLower(username)]
+}
+
+// Objek Request saat mendaftarkan user baru; hanya field ini yang bisa diisi oleh client
+// swagger:parameters userRegisterRequest
+type UserRegisterRequest struct {
+	Username string `json:"username" form:"username" valid:"required~Your username is required,unreserved~That username is reserved"`
+	Email    string `json:"email" form:"email" valid:"required~Your email is required,email~Invalid format email"`
+	Password string `json:"password" form:"password" valid:"required~Your password is required"`
+	Age      int    `json:"age" form:"age" valid:"required~Your age is required,numeric~Fill age with number,range(8|99)~minimum 8 years old"`
+}
 
 // Objek Response saat user berhasil dibuat
 // swagger:response userCreateResponse
@@ -14,14 +47,23 @@ type UserCreateResponse struct {
 // Objek Response saat user berhasil login
 // swagger:response userLoginResponse
 type UserLoginResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Objek Request saat menukar refresh token dengan token baru
+// swagger:parameters userRefreshRequest
+type UserRefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // Objek Request saat meng-update informasi user
 // swagger:parameters userUpdateRequest
 type UserUpdateRequest struct {
 	Email    string `json:"email" valid:"email~Invalid format email"`
-	Username string `json:"username"`
+	Username string `json:"username" valid:"unreserved~That username is reserved"`
 }
 
 // Objek Response saat informasi user berhasil di-update
@@ -33,3 +75,146 @@ type UserUpdateResponse struct {
 	Age       int        `json:"age"`
 	UpdatedAt *time.Time `json:"updated_at"`
 }
+
+// Objek Request saat meminta link reset password
+// swagger:parameters userForgotPasswordRequest
+type UserForgotPasswordRequest struct {
+	Email string `json:"email" valid:"required~Your email is required,email~Invalid format email"`
+}
+
+// Objek Request saat mengganti password dengan token reset
+// swagger:parameters userResetPasswordRequest
+type UserResetPasswordRequest struct {
+	Token    string `json:"token" valid:"required~Reset token is required"`
+	Password string `json:"password" valid:"required~Your password is required"`
+}
+
+// Objek Response saat login membutuhkan kode two-factor
+// swagger:response userMfaRequiredResponse
+type UserMfaRequiredResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Objek Request saat menyelesaikan login dengan kode two-factor
+// swagger:parameters userMfaLoginRequest
+type UserMfaLoginRequest struct {
+	MfaToken string `json:"mfa_token" valid:"required~MFA token is required"`
+	Code     string `json:"code" valid:"required~Code is required"`
+}
+
+// Objek Response saat memulai pendaftaran two-factor
+// swagger:response userMfaEnrollResponse
+type UserMfaEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthUri string `json:"otpauth_uri"`
+}
+
+// Objek Request saat mengonfirmasi two-factor dengan kode dari aplikasi authenticator
+// swagger:parameters userMfaConfirmRequest
+type UserMfaConfirmRequest struct {
+	Code string `json:"code" valid:"required~Code is required"`
+}
+
+// Objek Response saat two-factor berhasil diaktifkan
+// swagger:response userMfaConfirmResponse
+type UserMfaConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Objek Request saat menonaktifkan two-factor
+// swagger:parameters userMfaDisableRequest
+type UserMfaDisableRequest struct {
+	Password string `json:"password" valid:"required~Your password is required"`
+	Code     string `json:"code" valid:"required~Code is required"`
+}
+
+// Objek Request saat mengganti password
+// swagger:parameters userChangePasswordRequest
+type UserChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" valid:"required~Your current password is required"`
+	NewPassword     string `json:"new_password" valid:"required~Your password is required"`
+}
+
+// Objek Request saat admin mengganti role user
+// swagger:parameters userRoleRequest
+type UserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// Objek Response saat role user berhasil diganti
+// swagger:response userRoleResponse
+type UserRoleResponse struct {
+	Id       uint   `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Objek Response untuk satu sesi login aktif
+// swagger:response userSessionResponse
+type UserSessionResponse struct {
+	Id         uint       `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	Ip         string     `json:"ip"`
+	Current    bool       `json:"current"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+}
+
+// Objek Response berisi URL login ke provider OpenID Connect
+// swagger:response userOidcAuthorizeResponse
+type UserOidcAuthorizeResponse struct {
+	AuthorizationUrl string `json:"authorization_url"`
+}
+
+// Objek Response untuk identitas eksternal yang terhubung ke user
+// swagger:response userIdentityResponse
+type UserIdentityResponse struct {
+	Id        uint       `json:"id"`
+	Provider  string     `json:"provider"`
+	Subject   string     `json:"subject"`
+	Email     string     `json:"email"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// Objek Request saat meminta link login tanpa password
+// swagger:parameters userMagicLinkRequest
+type UserMagicLinkRequest struct {
+	Email string `json:"email" valid:"required~Your email is required,email~Invalid format email"`
+}
+
+// Objek Request saat menukar token magic link dengan token login
+// swagger:parameters userMagicLinkVerifyRequest
+type UserMagicLinkVerifyRequest struct {
+	Token string `json:"token" form:"token" valid:"required~Token is required"`
+}
+
+// Objek Request saat meng-update profil publik user
+// swagger:parameters userProfileRequest
+type UserProfileRequest struct {
+	DisplayName string `json:"display_name" valid:"maxstringlength(50)~Display name can have at most 50 characters"`
+	Bio         string `json:"bio" valid:"maxstringlength(160)~Bio can have at most 160 characters"`
+	Website     string `json:"website" valid:"maxstringlength(200)~Website can have at most 200 characters"`
+	AvatarUrl   string `json:"avatar_url" valid:"maxstringlength(500)~Avatar url can have at most 500 characters"`
+	Pronouns    string `json:"pronouns" valid:"maxstringlength(30)~Pronouns can have at most 30 characters"`
+	// IsPrivate dibiarkan jika tidak dikirim
+	IsPrivate *bool `json:"is_private"`
+}
+
+// Objek Response untuk profil publik user, tanpa email dan umur
+// swagger:response userProfileResponse
+type UserProfileResponse struct {
+	Id             uint       `json:"id"`
+	Username       string     `json:"username"`
+	DisplayName    string     `json:"display_name"`
+	Bio            string     `json:"bio"`
+	Website        string     `json:"website"`
+	AvatarUrl      string     `json:"avatar_url"`
+	Pronouns       string     `json:"pronouns"`
+	IsPrivate      bool       `json:"is_private"`
+	PhotoCount     int64      `json:"photo_count"`
+	FollowerCount  int64      `json:"follower_count"`
+	FollowingCount int64      `json:"following_count"`
+	CreatedAt      *time.Time `json:"created_at"`
+}
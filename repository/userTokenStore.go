@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserTokenInvalid = errors.New("token is invalid or has already been used")
+	ErrUserTokenExpired = errors.New("token is expired")
+)
+
+// UserTokenStore issues and consumes single-use tokens (see models.UserToken).
+type UserTokenStore struct {
+	db *gorm.DB
+}
+
+func NewUserTokenStore(db *gorm.DB) *UserTokenStore {
+	return &UserTokenStore{
+		db: db,
+	}
+}
+
+// Issue creates a token for purpose, invalidating any unused token the user already had for it.
+func (store *UserTokenStore) Issue(userId uint, purpose string, ttl time.Duration) (string, error) {
+	return store.IssueForEmail(userId, "", purpose, ttl)
+}
+
+// IssueForEmail is Issue for a token mailed to email. The address is stored with the token, so
+// whoever consumes it can tell whether the user still has it.
+func (store *UserTokenStore) IssueForEmail(userId uint, email string, purpose string, ttl time.Duration) (string, error) {
+	token, err := auth.GenerateOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = store.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userId, purpose).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.UserToken{
+			UserId:    userId,
+			Purpose:   purpose,
+			Email:     email,
+			TokenHash: auth.HashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Peek returns the token if it could still be consumed, without using it up.
+func (store *UserTokenStore) Peek(token string, purpose string) (models.UserToken, error) {
+	var userToken models.UserToken
+	err := store.db.Where("token_hash = ? AND purpose = ?", auth.HashToken(token), purpose).Take(&userToken).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return userToken, ErrUserTokenInvalid
+		}
+		return userToken, err
+	}
+
+	if userToken.UsedAt != nil {
+		return userToken, ErrUserTokenInvalid
+	}
+	if time.Now().After(userToken.ExpiresAt) {
+		return userToken, ErrUserTokenExpired
+	}
+
+	return userToken, nil
+}
+
+// Consume marks the token as used and returns it. A token can only be consumed once.
+func (store *UserTokenStore) Consume(token string, purpose string) (models.UserToken, error) {
+	userToken, err := store.Peek(token, purpose)
+	if err != nil {
+		return userToken, err
+	}
+
+	result := store.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", userToken.Id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return userToken, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return userToken, ErrUserTokenInvalid
+	}
+
+	return userToken, nil
+}
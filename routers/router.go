@@ -1,55 +1,155 @@
 package routers
 
 import (
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/auth"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/config"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/limiter"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/mailer"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/app/middleware"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/app/oidc"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/controller"
 	"github.com/wirapratamaz/H8FGA-MyGRAM/database"
+	"github.com/wirapratamaz/H8FGA-MyGRAM/repository"
 )
 
 func StartApp() *gin.Engine {
 
 	db := database.ConnectDB()
+	keyring, err := auth.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	auth.SetKeyring(keyring)
+
+	mail, err := mailer.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var loginAttempts limiter.Store = limiter.NewPostgresStore(db)
+	if config.Get("LOGIN_ATTEMPT_STORE", "postgres") == "memory" {
+		loginAttempts = limiter.NewMemoryStore()
+	}
+	loginLimiter := limiter.NewLoginLimiterFromEnv(loginAttempts)
+	magicLinkLimiter := limiter.NewMagicLinkLimiterFromEnv(loginAttempts)
+
 	router := gin.Default()
-	user := controller.NewUserController(db)
+	revocations := repository.NewRevocationStore(db)
+	revocations.StartPurging(time.Hour)
+	sessions := repository.NewSessionStore(db)
+	sessions.StartPurging(10 * time.Minute)
+	apiKeys := repository.NewApiKeyStore(db)
+	timelines := repository.NewTimelineStore(db)
+	timelines.StartWorkers(config.Int("FEED_FANOUT_WORKERS", 2))
+	authorized := middleware.Auth(revocations, apiKeys, sessions)
+	account := middleware.RequireScope(auth.ScopeAccount)
+	verified := middleware.RequireVerifiedEmail(db)
+	user := controller.NewUserController(db, revocations, sessions, apiKeys, mail, loginLimiter, magicLinkLimiter, oidc.NewProviderFromEnv(), timelines)
 	social := controller.NewSocialController(db)
-	photo := controller.NewPhotoController(db)
+	photo := controller.NewPhotoController(db, timelines)
 	comment := controller.NewCommentController(db)
+	key := controller.NewKeyController(keyring)
+	apiKey := controller.NewApiKeyController(apiKeys)
+	follow := controller.NewFollowController(db, timelines)
+	feed := controller.NewFeedController(db, timelines)
+	block := controller.NewBlockController(db)
+	like := controller.NewLikeController(db)
 
 	userGroup := router.Group("/users")
 	{
 		userGroup.POST("/login", user.UserLogin)
+		userGroup.POST("/login/mfa", user.MfaLogin)
 		userGroup.POST("/register", user.CreateUser)
-		userGroup.PUT("/", middleware.Auth(), user.UpdateUser)
-		userGroup.DELETE("/", middleware.Auth(), user.DeleteUser)
+		userGroup.POST("/refresh", user.RefreshToken)
+		userGroup.POST("/magic-link", user.RequestMagicLink)
+		userGroup.GET("/magic-link/verify", user.MagicLinkConfirm)
+		userGroup.POST("/magic-link/verify", user.MagicLinkLogin)
+		userGroup.POST("/logout", authorized, account, user.Logout)
+		userGroup.POST("/logout-all", authorized, account, user.LogoutAll)
+		userGroup.PUT("/password", authorized, account, user.ChangePassword)
+		userGroup.POST("/password/forgot", user.ForgotPassword)
+		userGroup.POST("/password/reset", user.ResetPassword)
+		userGroup.GET("/email/verify", user.VerifyEmail)
+		userGroup.POST("/email/verification", authorized, account, user.ResendEmailVerification)
+		userGroup.POST("/2fa/enroll", authorized, account, user.EnrollMfa)
+		userGroup.POST("/2fa/confirm", authorized, account, user.ConfirmMfa)
+		userGroup.POST("/2fa/disable", authorized, account, user.DisableMfa)
+		userGroup.PUT("/", authorized, account, user.UpdateUser)
+		userGroup.PUT("/profile", authorized, account, user.UpdateProfile)
+		userGroup.DELETE("/", authorized, account, user.DeleteUser)
+		userGroup.PUT("/:userId/role", authorized, account, middleware.RequireRole(auth.RoleAdmin), user.AssignRole)
+		userGroup.GET("/sessions", authorized, account, user.FindAllSession)
+		userGroup.DELETE("/sessions/:sessionId", authorized, account, user.DeleteSession)
+		userGroup.GET("/identities", authorized, account, user.FindAllIdentity)
+		userGroup.POST("/identities/oidc", authorized, account, user.LinkOidcIdentity)
+		userGroup.DELETE("/identities/:identityId", authorized, account, user.DeleteIdentity)
+		userGroup.POST("/passkeys/register/begin", authorized, account, user.BeginPasskeyRegistration)
+		userGroup.POST("/passkeys/register/finish", authorized, account, user.FinishPasskeyRegistration)
+		userGroup.POST("/passkeys/login/begin", user.BeginPasskeyLogin)
+		userGroup.POST("/passkeys/login/finish", user.FinishPasskeyLogin)
+		userGroup.GET("/passkeys", authorized, account, user.FindAllPasskey)
+		userGroup.DELETE("/passkeys/:passkeyId", authorized, account, user.DeletePasskey)
+		userGroup.POST("/api-keys", authorized, account, apiKey.CreateApiKey)
+		userGroup.GET("/api-keys", authorized, account, apiKey.FindAllApiKey)
+		userGroup.DELETE("/api-keys/:apiKeyId", authorized, account, apiKey.RevokeApiKey)
+		userGroup.GET("/follow-requests", authorized, middleware.RequireScope(auth.ScopeFollowsRead), follow.FindAllFollowRequest)
+		userGroup.POST("/follow-requests/:requestId/approve", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), follow.ApproveFollowRequest)
+		userGroup.DELETE("/follow-requests/:requestId", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), follow.RejectFollowRequest)
+		userGroup.GET("/:username", user.FindProfile)
+		userGroup.POST("/:username/follow", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), follow.FollowUser)
+		userGroup.DELETE("/:username/follow", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), follow.UnfollowUser)
+		userGroup.POST("/:username/block", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), block.BlockUser)
+		userGroup.DELETE("/:username/block", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), block.UnblockUser)
+		userGroup.POST("/:username/mute", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), block.MuteUser)
+		userGroup.DELETE("/:username/mute", authorized, middleware.RequireScope(auth.ScopeFollowsWrite), block.UnmuteUser)
+		userGroup.GET("/:username/followers", authorized, middleware.RequireScope(auth.ScopeFollowsRead), follow.FindAllFollower)
+		userGroup.GET("/:username/following", authorized, middleware.RequireScope(auth.ScopeFollowsRead), follow.FindAllFollowing)
+	}
+
+	authGroup := router.Group("/auth")
+	{
+		authGroup.GET("/oidc/login", user.OidcLogin)
+		authGroup.GET("/oidc/callback", user.OidcCallback)
 	}
 
 	socialGroup := router.Group("/socials")
 	{
-		socialGroup.GET("/", middleware.Auth(), social.FindAllSocial)
-		socialGroup.POST("/", middleware.Auth(), social.CreateSocial)
-		socialGroup.PUT("/:socialMediaId", middleware.Auth(), social.UpdateSocial)
-		socialGroup.DELETE("/:socialMediaId", middleware.Auth(), social.DeleteSocial)
+		socialGroup.GET("/", authorized, middleware.RequireScope(auth.ScopeSocialsRead), social.FindAllSocial)
+		socialGroup.POST("/", authorized, middleware.RequireScope(auth.ScopeSocialsWrite), social.CreateSocial)
+		socialGroup.PUT("/:socialMediaId", authorized, middleware.RequireScope(auth.ScopeSocialsWrite), social.UpdateSocial)
+		socialGroup.DELETE("/:socialMediaId", authorized, middleware.RequireScope(auth.ScopeSocialsWrite), social.DeleteSocial)
 	}
 
 	photoGroup := router.Group("/photos")
 	{
-		photoGroup.GET("/", middleware.Auth(), photo.FindAllPhoto)
-		photoGroup.POST("/", middleware.Auth(), photo.CreatePhoto)
-		photoGroup.PUT("/:photoId", middleware.Auth(), photo.UpdatePhoto)
-		photoGroup.DELETE("/:socialMediaId", middleware.Auth(), photo.DeletePhoto)
+		photoGroup.GET("/", authorized, middleware.RequireScope(auth.ScopePhotosRead), photo.FindAllPhoto)
+		photoGroup.POST("/", authorized, middleware.RequireScope(auth.ScopePhotosWrite), verified, photo.CreatePhoto)
+		photoGroup.PUT("/:photoId", authorized, middleware.RequireScope(auth.ScopePhotosWrite), photo.UpdatePhoto)
+		photoGroup.DELETE("/:photoId", authorized, middleware.RequireScope(auth.ScopePhotosWrite), photo.DeletePhoto)
+		photoGroup.POST("/:photoId/like", authorized, middleware.RequireScope(auth.ScopePhotosWrite), verified, like.LikePhoto)
+		photoGroup.DELETE("/:photoId/like", authorized, middleware.RequireScope(auth.ScopePhotosWrite), like.UnlikePhoto)
+		photoGroup.GET("/:photoId/likes", authorized, middleware.RequireScope(auth.ScopePhotosRead), like.FindAllLike)
 	}
 
 	commentGroup := router.Group("/comments")
 	{
-		commentGroup.GET("/", middleware.Auth(), comment.FindAllComment)
-		commentGroup.POST("/", middleware.Auth(), comment.CreateComment)
-		commentGroup.PUT("/:commentId", middleware.Auth(), comment.UpdateComment)
-		commentGroup.DELETE("/:commentId", middleware.Auth(), comment.DeleteComment)
+		commentGroup.GET("/", authorized, middleware.RequireScope(auth.ScopeCommentsRead), comment.FindAllComment)
+		commentGroup.POST("/", authorized, middleware.RequireScope(auth.ScopeCommentsWrite), verified, comment.CreateComment)
+		commentGroup.PUT("/:commentId", authorized, middleware.RequireScope(auth.ScopeCommentsWrite), comment.UpdateComment)
+		commentGroup.DELETE("/:commentId", authorized, middleware.RequireScope(auth.ScopeCommentsWrite), comment.DeleteComment)
+		commentGroup.GET("/reactions", authorized, middleware.RequireScope(auth.ScopeCommentsRead), comment.FindReactionSet)
+		commentGroup.POST("/:commentId/reactions", authorized, middleware.RequireScope(auth.ScopeCommentsWrite), verified, comment.AddReaction)
+		commentGroup.DELETE("/:commentId/reactions", authorized, middleware.RequireScope(auth.ScopeCommentsWrite), comment.RemoveReaction)
 	}
 
+	router.GET("/feed", authorized, middleware.RequireScope(auth.ScopePhotosRead), feed.FindFeed)
+	router.GET("/.well-known/jwks.json", key.JWKS)
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	return router